@@ -18,7 +18,6 @@ PROJECT_ROOT=$(cd .. && pwd)
 # 设置输出目录
 OUTPUT_DIR="$PROJECT_ROOT/dist-desktop"
 SOURCE_DIR="$PROJECT_ROOT/cmd/repackage-gui"
-REPACKAGE_DIR="$PROJECT_ROOT/cmd/repackage"
 
 echo -e "${BLUE}========================================${NC}"
 echo -e "${BLUE}  构建桌面应用程序${NC}"
@@ -67,6 +66,19 @@ create_app_icon() {
 EOF
 }
 
+# 构建在dify-plugin-daemon容器中执行的Linux版本repackage
+build_container_binaries() {
+    local dest_dir="$1"
+    
+    echo -e "${YELLOW}编译容器使用的Linux版本repackage...${NC}"
+    for arch in amd64 arm64; do
+        env GOOS=linux GOARCH=$arch CGO_ENABLED=0 \
+            go build -ldflags "-s -w -X main.version=1.0.0-desktop" \
+            -o "$dest_dir/repackage-linux-$arch" ./cmd/repackage/
+        chmod +x "$dest_dir/repackage-linux-$arch"
+    done
+}
+
 # 构建Mac应用程序包
 build_mac_app() {
     echo -e "${YELLOW}构建Mac应用程序包...${NC}"
@@ -87,21 +99,12 @@ build_mac_app() {
     # 构建repackage命令行工具
     go build -ldflags "-s -w -X main.version=1.0.0-desktop" -o "$resources_dir/repackage" ./cmd/repackage/
     
-    # 复制必要文件
-    cp "$REPACKAGE_DIR/plugin_repackaging.sh" "$resources_dir/"
-    
-    # 复制所有6个dify-plugin文件到Mac应用程序包
-    echo -e "${YELLOW}复制所有平台的dify-plugin文件...${NC}"
-    cp "$REPACKAGE_DIR"/dify-plugin-* "$resources_dir/" 2>/dev/null || true
-    
-    # 确保所有文件都复制成功
-    ls -la "$resources_dir"/dify-plugin-* 2>/dev/null || echo "警告: 某些dify-plugin文件可能缺失"
+    # 构建容器内使用的Linux版本repackage
+    build_container_binaries "$resources_dir"
     
     # 设置权限
     chmod +x "$macos_dir/$app_name"
     chmod +x "$resources_dir/repackage"
-    chmod +x "$resources_dir/plugin_repackaging.sh"
-    chmod +x "$resources_dir"/dify-plugin-* 2>/dev/null || true
     
     # 创建应用图标
     create_app_icon "$resources_dir"
@@ -207,15 +210,8 @@ build_windows_app() {
         go build -ldflags "-s -w -X main.version=1.0.0-desktop" \
         -o "$app_dir/repackage.exe" ./cmd/repackage/
     
-    # 复制必要文件
-    cp "$REPACKAGE_DIR/plugin_repackaging.sh" "$app_dir/"
-    
-    # 复制所有6个dify-plugin文件到Windows应用程序
-    echo -e "${YELLOW}复制所有平台的dify-plugin文件...${NC}"
-    cp "$REPACKAGE_DIR"/dify-plugin-* "$app_dir/" 2>/dev/null || true
-    
-    # 确保所有文件都复制成功
-    ls -la "$app_dir"/dify-plugin-* 2>/dev/null || echo "警告: 某些dify-plugin文件可能缺失"
+    # 构建容器内使用的Linux版本repackage
+    build_container_binaries "$app_dir"
     
     # 创建应用图标
     create_app_icon "$app_dir"
@@ -330,9 +326,8 @@ build_linux_appimage() {
         go build -ldflags "-s -w -X main.version=1.0.0-desktop" -o "$appdir/usr/bin/$app_name" ./cmd/repackage-gui/
         go build -ldflags "-s -w -X main.version=1.0.0-desktop" -o "$appdir/usr/bin/repackage" ./cmd/repackage/
         
-        # 复制必要文件
-        cp "$REPACKAGE_DIR/plugin_repackaging.sh" "$appdir/usr/bin/"
-        cp "$REPACKAGE_DIR"/dify-plugin-linux-* "$appdir/usr/bin/" 2>/dev/null || true
+        # 构建容器内使用的Linux版本repackage
+        build_container_binaries "$appdir/usr/bin"
         
         # 设置权限
         chmod +x "$appdir/usr/bin"/*
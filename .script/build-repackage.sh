@@ -11,9 +11,8 @@ SCRIPT_DIR=$(dirname "$0")
 cd "$SCRIPT_DIR"
 PROJECT_ROOT=$(cd .. && pwd)
 
-# 设置输出目录和源代码目录
+# 设置输出目录
 OUTPUT_DIR="$PROJECT_ROOT/bin"
-SOURCE_DIR="$PROJECT_ROOT/cmd/repackage"
 
 # 确保输出目录存在
 mkdir -p "$OUTPUT_DIR"
@@ -25,18 +24,14 @@ ARCH_NAME=$(uname -m)
 if [[ "$OS_TYPE" == "darwin" ]]; then
   if [[ "$ARCH_NAME" == "arm64" ]]; then
     OUTPUT_NAME="$OUTPUT_DIR/repackage-darwin-arm64"
-    DIFY_PLUGIN_NAME="dify-plugin-darwin-arm64-5g"
   else
     OUTPUT_NAME="$OUTPUT_DIR/repackage-darwin-amd64"
-    DIFY_PLUGIN_NAME="dify-plugin-darwin-amd64-5g"
   fi
 elif [[ "$OS_TYPE" == "linux" ]]; then
   if [[ "$ARCH_NAME" == "aarch64" || "$ARCH_NAME" == "arm64" ]]; then
     OUTPUT_NAME="$OUTPUT_DIR/repackage-linux-arm64"
-    DIFY_PLUGIN_NAME="dify-plugin-linux-arm64-5g"
   else
     OUTPUT_NAME="$OUTPUT_DIR/repackage-linux-amd64"
-    DIFY_PLUGIN_NAME="dify-plugin-linux-amd64-5g"
   fi
 else
   echo -e "${RED}不支持的操作系统: $OS_TYPE${NC}"
@@ -60,45 +55,20 @@ fi
 cd "$OUTPUT_DIR"
 ln -sf "$(basename $OUTPUT_NAME)" "repackage"
 
-# 确保plugin_repackaging.sh脚本在正确位置并具有执行权限
-if [ ! -f "$OUTPUT_DIR/plugin_repackaging.sh" ]; then
-  echo -e "${YELLOW}正在复制plugin_repackaging.sh到$OUTPUT_DIR...${NC}"
-  cp "$SOURCE_DIR/plugin_repackaging.sh" "$OUTPUT_DIR/"
-fi
-
-# 复制所有架构的dify-plugin文件到bin目录
-echo -e "${YELLOW}正在复制所有架构的dify-plugin文件到$OUTPUT_DIR...${NC}"
-
-# 定义所有需要复制的dify-plugin文件
-PLUGIN_FILES=(
-  "dify-plugin-darwin-arm64-5g"
-  "dify-plugin-darwin-amd64-5g"
-  "dify-plugin-linux-arm64-5g"
-  "dify-plugin-linux-amd64-5g"
-)
-
-# 复制每一个插件文件
-for plugin in "${PLUGIN_FILES[@]}"; do
-  SOURCE_PATH="$SOURCE_DIR/$plugin"
-  DEST_PATH="$OUTPUT_DIR/$plugin"
-  
-  if [ -f "$SOURCE_PATH" ]; then
-    echo -e "${YELLOW}复制 $plugin 到 $OUTPUT_DIR...${NC}"
-    cp "$SOURCE_PATH" "$DEST_PATH"
-    chmod +x "$DEST_PATH"
-  else
-    echo -e "${YELLOW}警告: 在 $SOURCE_PATH 找不到 $plugin 文件${NC}"
+# 交叉编译容器内使用的Linux版本（在dify-plugin-daemon容器中执行时需要）
+echo -e "${YELLOW}正在编译容器使用的Linux版本...${NC}"
+cd "$PROJECT_ROOT"
+for arch in amd64 arm64; do
+  CONTAINER_BINARY="$OUTPUT_DIR/repackage-linux-$arch"
+  if [ "$CONTAINER_BINARY" == "$OUTPUT_NAME" ]; then
+    continue
+  fi
+  env GOOS=linux GOARCH=$arch CGO_ENABLED=0 go build -o "$CONTAINER_BINARY" ./cmd/repackage/
+  if [ $? -ne 0 ]; then
+    echo -e "${YELLOW}警告: 编译 repackage-linux-$arch 失败，将无法在该架构的容器中执行${NC}"
   fi
 done
 
-# 确保当前架构的插件文件可用
-if [ ! -f "$OUTPUT_DIR/$DIFY_PLUGIN_NAME" ]; then
-  echo -e "${RED}警告: 找不到当前架构的插件文件: $DIFY_PLUGIN_NAME!${NC}"
-  echo -e "${YELLOW}请确保将对应版本的dify-plugin文件放在 cmd/repackage/ 目录下${NC}"
-fi
-
-chmod +x "$OUTPUT_DIR/plugin_repackaging.sh"
-
 echo -e "${GREEN}编译成功!${NC}"
 echo -e "${YELLOW}可执行文件: $OUTPUT_NAME${NC}"
 echo -e "${YELLOW}符号链接: $SYMLINK_NAME${NC}"
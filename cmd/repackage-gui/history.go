@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 数据目录中保存任务历史的文件
+const historyFile = "history.json"
+
+// 数据目录，保存任务历史、离线包和上传的文件，可通过REPACKAGE_GUI_DATA_DIR环境变量设置
+func getDataDir() string {
+	if dir := os.Getenv("REPACKAGE_GUI_DATA_DIR"); dir != "" {
+		// repackage在任务目录中执行，传给它的路径必须是绝对路径
+		if abs, err := filepath.Abs(dir); err == nil {
+			return abs
+		}
+		return dir
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "dify-plugin-repackager")
+	}
+	return filepath.Join(os.TempDir(), "dify-plugin-repackager")
+}
+
+// Artifact 任务生成的离线包
+type Artifact struct {
+	ID        string    `json:"id"`
+	JobID     string    `json:"jobId"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// historyStore 以JSON文件保存已结束的任务，包括请求参数、日志、耗时和离线包
+type historyStore struct {
+	path string
+}
+
+// 读取历史记录，文件不存在时返回空列表
+func (s *historyStore) load() ([]Job, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var history []Job
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("解析历史记录失败: %v", err)
+	}
+	return history, nil
+}
+
+// 先写入临时文件再重命名，避免写入中途退出时损坏历史记录
+func (s *historyStore) save(history []Job) error {
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// 处理/api/history：列出已结束的任务；/api/history/{id}：DELETE删除任务及其离线包；
+// /api/history/{id}/rerun：POST使用相同的参数重新执行
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/history"), "/")
+	id, action, _ := strings.Cut(path, "/")
+
+	switch {
+	case id == "" && r.Method == "GET":
+		respondJSON(w, jobs.history())
+
+	case id != "" && action == "" && r.Method == "DELETE":
+		if err := jobs.remove(id); err != nil {
+			respondJSONStatus(w, errorStatus(err), RepackageResponse{Success: false, Error: err.Error()})
+			return
+		}
+		respondJSON(w, RepackageResponse{Success: true, Message: "任务已删除"})
+
+	case id != "" && action == "rerun" && r.Method == "POST":
+		job, err := jobs.rerun(id)
+		if err != nil {
+			respondJSONStatus(w, errorStatus(err), RepackageResponse{Success: false, Error: err.Error()})
+			return
+		}
+		respondJSONStatus(w, http.StatusAccepted, job)
+
+	default:
+		http.Error(w, "不支持的请求", http.StatusMethodNotAllowed)
+	}
+}
+
+// 处理/api/artifacts：列出所有离线包；/api/artifacts/{id}：GET下载，DELETE删除
+func handleArtifacts(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/artifacts"), "/")
+
+	switch {
+	case id == "" && r.Method == "GET":
+		respondJSON(w, jobs.artifacts())
+
+	case id != "" && r.Method == "GET":
+		artifact, ok := jobs.artifact(id)
+		if !ok {
+			http.Error(w, "离线包不存在", http.StatusNotFound)
+			return
+		}
+		// 只提供数据目录中的文件，即使历史记录被改动也不会读取其他位置
+		filePath, err := containedPath(jobs.dir, artifact.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(filePath)))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeFile(w, r, filePath)
+
+	case id != "" && r.Method == "DELETE":
+		if err := jobs.removeArtifact(id); err != nil {
+			respondJSONStatus(w, errorStatus(err), RepackageResponse{Success: false, Error: err.Error()})
+			return
+		}
+		respondJSON(w, RepackageResponse{Success: true, Message: "离线包已删除"})
+
+	default:
+		http.Error(w, "不支持的请求", http.StatusMethodNotAllowed)
+	}
+}
+
+// 任务和离线包操作错误对应的HTTP状态码
+func errorStatus(err error) int {
+	switch err {
+	case errJobNotFound, errArtifactNotFound:
+		return http.StatusNotFound
+	case errJobNotFinished:
+		return http.StatusConflict
+	case errOutsideDataDir:
+		return http.StatusForbidden
+	case errQueueFull:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 任务状态
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+// 排队任务数上限，超过后拒绝新任务
+const maxQueuedJobs = 32
+
+var (
+	errQueueFull        = errors.New("任务队列已满，请稍后再试")
+	errJobFinished      = errors.New("任务已结束")
+	errJobNotFinished   = errors.New("任务尚未结束")
+	errJobNotFound      = errors.New("任务不存在")
+	errArtifactNotFound = errors.New("离线包不存在")
+)
+
+// Job 一次重新打包任务
+type Job struct {
+	ID         string             `json:"id"`
+	State      string             `json:"state"`
+	Request    RepackageRequest   `json:"request"`
+	Progress   ProgressUpdate     `json:"progress"` // 当前阶段
+	Result     *RepackageResponse `json:"result,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	StartedAt  *time.Time         `json:"startedAt,omitempty"`
+	FinishedAt *time.Time         `json:"finishedAt,omitempty"`
+	Duration   float64            `json:"duration,omitempty"` // 执行耗时（秒）
+
+	dir     string             // 任务的工作目录，离线包输出到其中的output目录
+	ctx     context.Context    // 取消任务时取消
+	cancel  context.CancelFunc // 取消任务
+	done    chan struct{}      // 任务结束时关闭
+	events  []jobEvent         // 已产生的事件，SSE客户端连接时从头重放
+	changed chan struct{}      // 产生新事件或任务结束时关闭并替换
+}
+
+// jobEvent 推送给SSE客户端的事件，Type为stage（阶段变化）或log（一行输出）
+type jobEvent struct {
+	Type     string
+	Progress ProgressUpdate
+}
+
+// 任务是否已结束
+func (j *Job) finished() bool {
+	return j.State == jobSucceeded || j.State == jobFailed || j.State == jobCanceled
+}
+
+// 任务的离线包输出目录
+func (j *Job) outputDir() string {
+	return filepath.Join(j.dir, "output")
+}
+
+// jobManager 管理任务队列，由固定数量的worker并发执行，每个任务使用独立的工作目录；
+// 已结束的任务保存到历史记录，重启后仍可查看和下载
+type jobManager struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	order []string // 按创建顺序排列的任务ID
+	queue chan *Job
+	dir   string
+	store *historyStore
+}
+
+var jobs *jobManager
+
+// 创建任务管理器，加载数据目录中的历史记录并启动worker
+func newJobManager(dataDir string, workers int) (*jobManager, error) {
+	m := &jobManager{
+		jobs:  map[string]*Job{},
+		queue: make(chan *Job, maxQueuedJobs),
+		dir:   filepath.Join(dataDir, "jobs"),
+		store: &historyStore{path: filepath.Join(dataDir, historyFile)},
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	history, err := m.store.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range history {
+		job := &history[i]
+		job.dir = filepath.Join(m.dir, job.ID)
+		job.done = make(chan struct{})
+		job.changed = make(chan struct{})
+		close(job.done)
+		// 重放保存的日志
+		if job.Result != nil {
+			for _, line := range strings.Split(strings.TrimRight(job.Result.Output, "\n"), "\n") {
+				job.events = append(job.events, jobEvent{Type: "log", Progress: ProgressUpdate{Message: line}})
+			}
+		}
+		m.jobs[job.ID] = job
+		m.order = append(m.order, job.ID)
+	}
+
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	log.Printf("🧵 任务队列已启动，并发数: %d，数据目录: %s，历史任务: %d", workers, dataDir, len(history))
+	return m, nil
+}
+
+// 并发执行的任务数，可通过REPACKAGE_GUI_WORKERS环境变量设置
+func getWorkerCount() int {
+	if workers := os.Getenv("REPACKAGE_GUI_WORKERS"); workers != "" {
+		if n, err := strconv.Atoi(workers); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 2
+}
+
+// 生成任务ID，以创建时间开头便于排序和排查
+func newJobID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// 校验请求并加入队列
+func (m *jobManager) submit(req RepackageRequest) (Job, error) {
+	if _, err := buildRepackageArgs(req); err != nil {
+		return Job{}, err
+	}
+	if req.Mode == "local" {
+		// 文件名只用于显示，以上传时保存的为准
+		filePath, _ := uploadPath(req.UploadID)
+		req.FileName = filepath.Base(filePath)
+	}
+
+	id := newJobID()
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:        id,
+		State:     jobQueued,
+		Request:   req,
+		CreatedAt: time.Now(),
+		dir:       filepath.Join(m.dir, id),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		changed:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case m.queue <- job:
+	default:
+		cancel()
+		return Job{}, errQueueFull
+	}
+	m.jobs[id] = job
+	m.order = append(m.order, id)
+	log.Printf("📥 任务已加入队列: %s (%s)", id, req.Mode)
+	return *job, nil
+}
+
+// 获取任务的快照
+func (m *jobManager) get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// 所有任务的快照，最新的在前
+func (m *jobManager) list() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Job, 0, len(m.order))
+	for i := len(m.order) - 1; i >= 0; i-- {
+		list = append(list, *m.jobs[m.order[i]])
+	}
+	return list
+}
+
+// 等待任务结束并返回结果
+func (m *jobManager) wait(id string) (Job, bool) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Job{}, false
+	}
+	<-job.done
+	return m.get(id)
+}
+
+// 取消任务：排队中的任务直接结束，执行中的任务中断repackage并在其退出后清理工作目录
+func (m *jobManager) cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, errJobNotFound
+	}
+	if job.finished() {
+		return *job, errJobFinished
+	}
+
+	log.Printf("🛑 取消任务: %s", id)
+	job.cancel()
+	if job.State == jobQueued {
+		now := time.Now()
+		job.State = jobCanceled
+		job.FinishedAt = &now
+		job.Result = &RepackageResponse{Success: false, Error: "任务已取消", JobID: id}
+		close(job.done)
+		m.notify(job)
+		m.persist()
+	}
+	return *job, nil
+}
+
+// 取消所有未结束的任务并等待其清理完毕，用于关闭服务器
+func (m *jobManager) shutdown() {
+	m.mu.Lock()
+	var pending []*Job
+	for _, job := range m.jobs {
+		if !job.finished() {
+			pending = append(pending, job)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, job := range pending {
+		m.cancel(job.ID)
+	}
+	for _, job := range pending {
+		<-job.done
+	}
+}
+
+// 记录任务的一个进度事件并通知SSE客户端，没有阶段的输出行归入当前阶段
+func (m *jobManager) publish(job *Job, update ProgressUpdate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	eventType := "log"
+	if update.Stage != "" {
+		eventType = "stage"
+		job.Progress = update
+	} else {
+		update.Stage = job.Progress.Stage
+		update.Percent = job.Progress.Percent
+	}
+	job.events = append(job.events, jobEvent{Type: eventType, Progress: update})
+	m.notify(job)
+}
+
+// 唤醒等待该任务事件的SSE客户端，调用时需持有锁
+func (m *jobManager) notify(job *Job) {
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// 获取任务从第next个开始的事件，以及任务快照和下一次变化的通知
+func (m *jobManager) eventsSince(id string, next int) ([]jobEvent, Job, <-chan struct{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, Job{}, nil, false
+	}
+	var events []jobEvent
+	if next < len(job.events) {
+		events = append(events, job.events[next:]...)
+	}
+	return events, *job, job.changed, true
+}
+
+// 将已结束的任务写入历史记录，调用时需持有锁
+func (m *jobManager) persist() {
+	var history []Job
+	for _, id := range m.order {
+		if job := m.jobs[id]; job.finished() {
+			history = append(history, *job)
+		}
+	}
+	if err := m.store.save(history); err != nil {
+		log.Printf("保存历史记录失败: %v", err)
+	}
+}
+
+// 已结束的任务，最新的在前
+func (m *jobManager) history() []Job {
+	history := []Job{}
+	for _, job := range m.list() {
+		if job.finished() {
+			history = append(history, job)
+		}
+	}
+	return history
+}
+
+// 删除已结束的任务及其离线包
+func (m *jobManager) remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return errJobNotFound
+	}
+	if !job.finished() {
+		return errJobNotFinished
+	}
+
+	if err := os.RemoveAll(job.dir); err != nil {
+		return err
+	}
+	delete(m.jobs, id)
+	for i, jobID := range m.order {
+		if jobID == id {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	m.persist()
+	log.Printf("🗑️ 删除任务: %s", id)
+	return nil
+}
+
+// 使用历史任务的参数创建新任务
+func (m *jobManager) rerun(id string) (Job, error) {
+	job, ok := m.get(id)
+	if !ok {
+		return Job{}, errJobNotFound
+	}
+	return m.submit(job.Request)
+}
+
+// 所有离线包，最新的在前
+func (m *jobManager) artifacts() []Artifact {
+	artifacts := []Artifact{}
+	for _, job := range m.list() {
+		if job.Result != nil {
+			artifacts = append(artifacts, job.Result.Artifacts...)
+		}
+	}
+	return artifacts
+}
+
+// 按ID查找离线包
+func (m *jobManager) artifact(id string) (Artifact, bool) {
+	for _, artifact := range m.artifacts() {
+		if artifact.ID == id {
+			return artifact, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// 删除离线包文件，并从所属任务的结果中移除
+func (m *jobManager) removeArtifact(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if job.Result == nil {
+			continue
+		}
+		for i, artifact := range job.Result.Artifacts {
+			if artifact.ID != id {
+				continue
+			}
+			filePath, err := containedPath(m.dir, artifact.Path)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			// 结果是共享的，替换而不是原地修改，避免影响已返回的快照
+			result := *job.Result
+			result.Artifacts = append(append([]Artifact{}, result.Artifacts[:i]...), result.Artifacts[i+1:]...)
+			result.Files = nil
+			for _, remaining := range result.Artifacts {
+				result.Files = append(result.Files, remaining.Name)
+			}
+			job.Result = &result
+			m.persist()
+			log.Printf("🗑️ 删除离线包: %s", artifact.Name)
+			return nil
+		}
+	}
+	return errArtifactNotFound
+}
+
+// 从队列中依次取出任务执行
+func (m *jobManager) worker() {
+	for job := range m.queue {
+		m.run(job)
+	}
+}
+
+func (m *jobManager) run(job *Job) {
+	m.mu.Lock()
+	if job.State != jobQueued {
+		// 排队时已被取消
+		m.mu.Unlock()
+		return
+	}
+	started := time.Now()
+	job.State = jobRunning
+	job.StartedAt = &started
+	req := job.Request
+	m.mu.Unlock()
+
+	log.Printf("▶️ 开始执行任务: %s", job.ID)
+	var result RepackageResponse
+	if err := os.MkdirAll(job.outputDir(), 0755); err != nil {
+		result = RepackageResponse{Success: false, Error: "创建任务目录失败: " + err.Error()}
+	} else {
+		result = executeRepackaging(job.ctx, req, job.dir, job.outputDir(), func(update ProgressUpdate) {
+			m.publish(job, update)
+		})
+	}
+	result.JobID = job.ID
+
+	// 被取消的任务删除工作目录中不完整的输出
+	canceled := job.ctx.Err() != nil
+	if canceled {
+		result.Success = false
+		result.Error = "任务已取消"
+		if err := os.RemoveAll(job.dir); err != nil {
+			log.Printf("清理任务目录失败: %v", err)
+		}
+	}
+
+	// 为离线包分配ID，之后按ID下载和删除；不在任务输出目录中的文件不予管理
+	artifacts := result.Artifacts
+	result.Artifacts = nil
+	for _, artifact := range artifacts {
+		if _, err := containedPath(job.outputDir(), artifact.Path); err != nil {
+			log.Printf("⚠️ 忽略输出目录之外的离线包: %s", artifact.Path)
+			continue
+		}
+		artifact.ID = fmt.Sprintf("%s-%d", job.ID, len(result.Artifacts)+1)
+		artifact.JobID = job.ID
+		artifact.CreatedAt = time.Now()
+		result.Artifacts = append(result.Artifacts, artifact)
+	}
+
+	m.mu.Lock()
+	finished := time.Now()
+	job.Result = &result
+	job.FinishedAt = &finished
+	job.Duration = finished.Sub(started).Seconds()
+	switch {
+	case canceled:
+		job.State = jobCanceled
+	case result.Success:
+		job.State = jobSucceeded
+	default:
+		job.State = jobFailed
+	}
+	m.notify(job)
+	m.persist()
+	m.mu.Unlock()
+	close(job.done)
+
+	log.Printf("⏹️ 任务结束: %s (%s, 耗时 %s)", job.ID, job.State, finished.Sub(started).Round(time.Second))
+}
+
+// 处理/api/jobs：GET列出任务，POST创建任务并立即返回任务ID
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		respondJSON(w, jobs.list())
+
+	case "POST":
+		var req RepackageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, RepackageResponse{
+				Success: false,
+				Error:   "请求解析失败: " + err.Error(),
+			})
+			return
+		}
+
+		job, err := jobs.submit(req)
+		if err == errQueueFull {
+			respondJSONStatus(w, http.StatusServiceUnavailable, RepackageResponse{Success: false, Error: err.Error()})
+			return
+		}
+		if err != nil {
+			respondJSON(w, RepackageResponse{Success: false, Error: err.Error()})
+			return
+		}
+		respondJSONStatus(w, http.StatusAccepted, job)
+
+	default:
+		http.Error(w, "只支持GET和POST请求", http.StatusMethodNotAllowed)
+	}
+}
+
+// 处理/api/jobs/{id}：GET返回任务状态和结果，DELETE取消任务；/api/jobs/{id}/events：以SSE推送任务进度
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	job, ok := jobs.get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("任务不存在: %s", id), http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == "GET":
+		respondJSON(w, job)
+	case action == "" && r.Method == "DELETE":
+		job, err := jobs.cancel(id)
+		if err == errJobFinished {
+			respondJSONStatus(w, http.StatusConflict, RepackageResponse{Success: false, Error: err.Error(), JobID: id})
+			return
+		}
+		respondJSON(w, job)
+	case action == "events" && r.Method == "GET":
+		handleJobEvents(w, r, id)
+	case action == "":
+		http.Error(w, "只支持GET和DELETE请求", http.StatusMethodNotAllowed)
+	case action == "events":
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// 以Server-Sent Events推送任务的阶段变化和每行输出，任务结束时发送done事件。
+// 新连接先重放已有事件，断线重连时根据Last-Event-ID从中断处继续
+func handleJobEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "不支持流式响应", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	next := 0
+	if lastID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		next = lastID + 1
+	}
+
+	for {
+		events, job, changed, ok := jobs.eventsSince(id, next)
+		if !ok {
+			return
+		}
+		for _, event := range events {
+			writeSSE(w, next, event.Type, event.Progress)
+			next++
+		}
+		if job.finished() {
+			writeSSE(w, next, "done", job)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// 写入一条SSE事件
+func writeSSE(w io.Writer, id int, event string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, payload)
+}
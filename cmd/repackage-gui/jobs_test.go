@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 设置REPACKAGE_GUI_FAKE_CLI时测试程序本身作为repackage执行
+func TestMain(m *testing.M) {
+	if os.Getenv("REPACKAGE_GUI_FAKE_CLI") == "1" {
+		os.Exit(fakeRepackage(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// 模拟repackage的market命令：名称为slow时一直运行直到被中断，为broken时失败，其他名称生成离线包
+func fakeRepackage(args []string) int {
+	var outputDir string
+	for i, arg := range args {
+		if arg == "--output-dir" && i+1 < len(args) {
+			outputDir = args[i+1]
+		}
+	}
+	name := args[len(args)-2]
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.Encode(CLIEvent{Type: "stage", Stage: "download"})
+	fmt.Fprintf(os.Stderr, "downloading %s\n", name)
+
+	switch name {
+	case "slow":
+		encoder.Encode(CLIEvent{Type: "stage", Stage: "pip download"})
+		select {
+		case <-interrupted:
+			fmt.Fprintln(os.Stderr, "interrupted")
+			return 130
+		case <-time.After(time.Minute):
+			return 1
+		}
+	case "broken":
+		encoder.Encode(CLIEvent{Type: "error", Message: "pip download failed"})
+		return 1
+	}
+
+	encoder.Encode(CLIEvent{Type: "stage", Stage: "package"})
+	path := filepath.Join(outputDir, name+"-offline.difypkg")
+	if err := os.WriteFile(path, []byte("package"), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	encoder.Encode(CLIEvent{Type: "artifact", Path: path, Size: 7, SHA256: "abc"})
+	return 0
+}
+
+// 将测试程序复制为PATH中的repackage，并创建执行任务的jobManager
+func setupFakeCLI(t *testing.T, workers int) string {
+	t.Helper()
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binDir := t.TempDir()
+	name := "repackage"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	if err := os.WriteFile(filepath.Join(binDir, name), content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("REPACKAGE_GUI_FAKE_CLI", "1")
+
+	dataDir := filepath.Join(t.TempDir(), "data")
+	m, err := newJobManager(dataDir, workers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs = m
+	t.Cleanup(m.shutdown)
+	return dataDir
+}
+
+func marketRequest(name string) string {
+	return fmt.Sprintf(`{"mode":"market","author":"langgenius","name":%q,"version":"0.0.1"}`, name)
+}
+
+// 通过POST /api/jobs提交任务
+func postJob(t *testing.T, body string) (int, Job) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleJobs(rec, httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body)))
+
+	var job Job
+	if rec.Code == http.StatusAccepted {
+		if err := json.NewDecoder(rec.Body).Decode(&job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, job
+}
+
+// 调用/api/jobs/{id}下的接口
+func callJob(t *testing.T, method, path string) (int, Job) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleJob(rec, httptest.NewRequest(method, path, nil))
+
+	var job Job
+	json.NewDecoder(rec.Body).Decode(&job)
+	return rec.Code, job
+}
+
+// 等待任务进入指定状态
+func waitForState(t *testing.T, id, state string) Job {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, _ := jobs.get(id); job.State == state {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	job, _ := jobs.get(id)
+	t.Fatalf("job %s is %s, want %s", id, job.State, state)
+	return job
+}
+
+func TestJobQueueFull(t *testing.T) {
+	setupDataDir(t)
+
+	for i := 0; i < maxQueuedJobs; i++ {
+		if code, _ := postJob(t, marketRequest("agent")); code != http.StatusAccepted {
+			t.Fatalf("job %d: status %d, want %d", i, code, http.StatusAccepted)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handleJobs(rec, httptest.NewRequest("POST", "/api/jobs", strings.NewReader(marketRequest("agent"))))
+	var resp RepackageResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusServiceUnavailable || resp.Success || resp.Error != errQueueFull.Error() {
+		t.Errorf("status %d, response %+v, want %d with %q", rec.Code, resp, http.StatusServiceUnavailable, errQueueFull)
+	}
+	if len(jobs.list()) != maxQueuedJobs {
+		t.Errorf("%d jobs listed, want %d", len(jobs.list()), maxQueuedJobs)
+	}
+
+}
+
+func TestJobRun(t *testing.T) {
+	dataDir := setupFakeCLI(t, 1)
+
+	code, job := postJob(t, marketRequest("agent"))
+	if code != http.StatusAccepted || job.ID == "" || job.State != jobQueued {
+		t.Fatalf("status %d, job %+v", code, job)
+	}
+
+	job, _ = jobs.wait(job.ID)
+	if job.State != jobSucceeded || job.Result == nil || !job.Result.Success {
+		t.Fatalf("job %+v, result %+v", job, job.Result)
+	}
+	if job.StartedAt == nil || job.FinishedAt == nil {
+		t.Error("start and finish times are not set")
+	}
+	if job.Progress.Stage != "package" || job.Progress.Percent != stagePercents["package"] {
+		t.Errorf("progress %+v, want the package stage", job.Progress)
+	}
+
+	if len(job.Result.Artifacts) != 1 {
+		t.Fatalf("artifacts %+v, want one", job.Result.Artifacts)
+	}
+	artifact := job.Result.Artifacts[0]
+	if artifact.ID != job.ID+"-1" || artifact.JobID != job.ID || artifact.Name != "agent-offline.difypkg" {
+		t.Errorf("artifact %+v", artifact)
+	}
+	// 离线包写入任务自己的输出目录
+	if want := filepath.Join(dataDir, "jobs", job.ID, "output", "agent-offline.difypkg"); artifact.Path != want {
+		t.Errorf("artifact path %s, want %s", artifact.Path, want)
+	}
+
+	code, got := callJob(t, "GET", "/api/jobs/"+job.ID)
+	if code != http.StatusOK || got.State != jobSucceeded {
+		t.Errorf("GET status %d, state %s", code, got.State)
+	}
+	if code, _ := callJob(t, "GET", "/api/jobs/missing"); code != http.StatusNotFound {
+		t.Errorf("GET missing job: status %d, want %d", code, http.StatusNotFound)
+	}
+
+	_, failed := postJob(t, marketRequest("broken"))
+	failed, _ = jobs.wait(failed.ID)
+	if failed.State != jobFailed || failed.Result.Success || !strings.Contains(failed.Result.Output, "pip download failed") {
+		t.Errorf("failed job %s, result %+v", failed.State, failed.Result)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	setupDataDir(t)
+
+	_, job := postJob(t, marketRequest("agent"))
+	code, canceled := callJob(t, "DELETE", "/api/jobs/"+job.ID)
+	if code != http.StatusOK || canceled.State != jobCanceled || canceled.FinishedAt == nil {
+		t.Fatalf("status %d, job %+v", code, canceled)
+	}
+	if canceled.Result == nil || canceled.Result.Success {
+		t.Errorf("result %+v, want a failure", canceled.Result)
+	}
+
+	// 排队中取消的任务立即结束，不会再被执行
+	done := make(chan struct{})
+	go func() {
+		jobs.wait(job.ID)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("canceled job did not finish")
+	}
+	jobs.run(jobs.jobs[job.ID])
+	if job, _ := jobs.get(job.ID); job.State != jobCanceled || job.StartedAt != nil {
+		t.Errorf("canceled job was started: %+v", job)
+	}
+
+	if code, _ := callJob(t, "DELETE", "/api/jobs/"+job.ID); code != http.StatusConflict {
+		t.Errorf("second cancel: status %d, want %d", code, http.StatusConflict)
+	}
+	if history := jobs.history(); len(history) != 1 || history[0].ID != job.ID {
+		t.Errorf("history %+v, want the canceled job", history)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	setupFakeCLI(t, 1)
+
+	_, job := postJob(t, marketRequest("slow"))
+	// 进入pip download阶段时repackage已经在处理中断
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if job, _ := jobs.get(job.ID); job.Progress.Stage == "pip download" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job did not reach the pip download stage")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 执行中的任务在repackage退出后才结束
+	code, running := callJob(t, "DELETE", "/api/jobs/"+job.ID)
+	if code != http.StatusOK || running.State != jobRunning {
+		t.Fatalf("status %d, state %s, want %s", code, running.State, jobRunning)
+	}
+
+	job, _ = jobs.wait(job.ID)
+	if job.State != jobCanceled || job.Result.Success || job.Result.Error != "任务已取消" {
+		t.Errorf("job %s, result %+v", job.State, job.Result)
+	}
+	if !strings.Contains(job.Result.Output, "interrupted") {
+		t.Errorf("repackage was not interrupted, output: %q", job.Result.Output)
+	}
+	if _, err := os.Stat(filepath.Join(jobs.dir, job.ID)); !os.IsNotExist(err) {
+		t.Errorf("job directory was not removed: %v", err)
+	}
+}
+
+func TestJobHistoryPersisted(t *testing.T) {
+	dataDir := setupFakeCLI(t, 1)
+
+	_, succeeded := postJob(t, marketRequest("agent"))
+	succeeded, _ = jobs.wait(succeeded.ID)
+	_, failed := postJob(t, marketRequest("broken"))
+	failed, _ = jobs.wait(failed.ID)
+
+	// 重新加载数据目录，模拟服务器重启
+	reloaded, err := newJobManager(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs = reloaded
+
+	history := jobs.history()
+	if len(history) != 2 || history[0].ID != failed.ID || history[1].ID != succeeded.ID {
+		t.Fatalf("history %+v, want the failed and succeeded jobs, newest first", history)
+	}
+	if history[0].State != jobFailed || history[1].State != jobSucceeded {
+		t.Errorf("states %s, %s", history[0].State, history[1].State)
+	}
+	if history[1].Request.Name != "agent" || history[1].Result.Output != succeeded.Result.Output {
+		t.Errorf("request and output were not saved: %+v", history[1])
+	}
+
+	// 重启后仍可下载离线包
+	artifactID := succeeded.Result.Artifacts[0].ID
+	rec := httptest.NewRecorder()
+	handleArtifacts(rec, httptest.NewRequest("GET", "/api/artifacts/"+artifactID, nil))
+	if body, _ := io.ReadAll(rec.Body); rec.Code != http.StatusOK || string(body) != "package" {
+		t.Errorf("download: status %d, body %q", rec.Code, body)
+	}
+
+	// 删除的任务不再出现在历史记录中
+	rec = httptest.NewRecorder()
+	handleHistory(rec, httptest.NewRequest("DELETE", "/api/history/"+failed.ID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d", rec.Code)
+	}
+	reloaded, err = newJobManager(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history := reloaded.history(); len(history) != 1 || history[0].ID != succeeded.ID {
+		t.Errorf("history after delete %+v", history)
+	}
+}
+
+// sseEvent 解析后的一条SSE事件
+type sseEvent struct {
+	ID    int
+	Event string
+	Data  string
+}
+
+// 读取SSE事件，直到done事件或连接关闭
+func readSSE(t *testing.T, r io.Reader, onEvent func(sseEvent)) []sseEvent {
+	t.Helper()
+	var (
+		events  []sseEvent
+		current sseEvent
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			current.ID, _ = strconv.Atoi(strings.TrimPrefix(line, "id: "))
+		case strings.HasPrefix(line, "event: "):
+			current.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.Data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			events = append(events, current)
+			if onEvent != nil {
+				onEvent(current)
+			}
+			if current.Event == "done" {
+				return events
+			}
+			current = sseEvent{}
+		}
+	}
+	return events
+}
+
+// 请求任务的事件流，lastEventID为负数时不发送Last-Event-ID
+func getJobEvents(t *testing.T, id string, lastEventID int) []sseEvent {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/jobs/"+id+"/events", nil)
+	if lastEventID >= 0 {
+		req.Header.Set("Last-Event-ID", strconv.Itoa(lastEventID))
+	}
+	rec := httptest.NewRecorder()
+	handleJob(rec, req)
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type %q", got)
+	}
+	return readSSE(t, rec.Body, nil)
+}
+
+func TestJobEventsReplay(t *testing.T) {
+	dataDir := setupFakeCLI(t, 1)
+
+	_, job := postJob(t, marketRequest("agent"))
+	job, _ = jobs.wait(job.ID)
+
+	events := getJobEvents(t, job.ID, -1)
+	if len(events) < 4 {
+		t.Fatalf("events %+v, want the stages, logs and done", events)
+	}
+	var stages, logs []string
+	for i, event := range events {
+		if event.ID != i {
+			t.Errorf("event %d has id %d", i, event.ID)
+		}
+		var update ProgressUpdate
+		json.Unmarshal([]byte(event.Data), &update)
+		switch event.Event {
+		case "stage":
+			stages = append(stages, update.Stage)
+		case "log":
+			logs = append(logs, update.Message)
+		}
+	}
+	if want := []string{"download", "package"}; !reflect.DeepEqual(stages, want) {
+		t.Errorf("stages %q, want %q", stages, want)
+	}
+	if len(logs) != 1 || logs[0] != "downloading agent" {
+		t.Errorf("logs %q", logs)
+	}
+
+	done := events[len(events)-1]
+	var finished Job
+	json.Unmarshal([]byte(done.Data), &finished)
+	if done.Event != "done" || finished.State != jobSucceeded {
+		t.Errorf("last event %+v, want done with a succeeded job", done)
+	}
+
+	// 断线重连时从Last-Event-ID之后继续，不重复已收到的事件
+	resumed := getJobEvents(t, job.ID, 1)
+	if !reflect.DeepEqual(resumed, events[2:]) {
+		t.Errorf("resumed events %+v, want %+v", resumed, events[2:])
+	}
+	if resumed := getJobEvents(t, job.ID, done.ID); len(resumed) != 1 || resumed[0].Event != "done" {
+		t.Errorf("events after done %+v, want only done", resumed)
+	}
+
+	// 重启后从保存的输出重放日志
+	reloaded, err := newJobManager(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs = reloaded
+	replayed := getJobEvents(t, job.ID, -1)
+	if len(replayed) < 2 || replayed[0].Event != "log" || replayed[len(replayed)-1].Event != "done" {
+		t.Errorf("replayed events %+v", replayed)
+	}
+}
+
+func TestJobEventsStream(t *testing.T) {
+	setupFakeCLI(t, 1)
+	server := httptest.NewServer(http.HandlerFunc(handleJob))
+	defer server.Close()
+
+	_, job := postJob(t, marketRequest("slow"))
+	resp, err := http.Get(server.URL + "/api/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// 事件实时推送：收到pip download阶段后取消任务，随后收到done事件
+	events := readSSE(t, resp.Body, func(event sseEvent) {
+		if event.Event == "stage" && strings.Contains(event.Data, `"pip download"`) {
+			callJob(t, "DELETE", "/api/jobs/"+job.ID)
+		}
+	})
+	if len(events) == 0 || events[len(events)-1].Event != "done" {
+		t.Fatalf("events %+v, want done last", events)
+	}
+	var finished Job
+	json.Unmarshal([]byte(events[len(events)-1].Data), &finished)
+	if finished.State != jobCanceled {
+		t.Errorf("done with state %s, want %s", finished.State, jobCanceled)
+	}
+
+	if code, _ := callJob(t, "POST", "/api/jobs/"+job.ID+"/events"); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST events: status %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
 	"net/http"
@@ -17,6 +16,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -30,7 +30,8 @@ var templateFiles embed.FS
 type RepackageRequest struct {
 	Mode       string `json:"mode"`       // "local", "market", "github"
 	Execution  string `json:"execution"`  // "local", "docker", "new-docker"
-	FilePath   string `json:"filePath"`   // for local mode
+	UploadID   string `json:"uploadId"`   // for local mode, returned by /api/upload
+	FileName   string `json:"fileName"`   // for local mode, set from the upload
 	Author     string `json:"author"`     // for market mode
 	Name       string `json:"name"`       // for market mode
 	Version    string `json:"version"`    // for market mode
@@ -40,18 +41,47 @@ type RepackageRequest struct {
 }
 
 type RepackageResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Output  string `json:"output"`
-	Error   string `json:"error"`
+	Success   bool       `json:"success"`
+	Message   string     `json:"message"`
+	Output    string     `json:"output"`
+	Error     string     `json:"error"`
+	Files     []string   `json:"files,omitempty"`     // 生成的离线包文件名
+	JobID     string     `json:"jobId,omitempty"`     // 生成离线包的任务
+	UploadID  string     `json:"uploadId,omitempty"`  // 上传文件的ID，本地模式的任务通过它引用文件
+	Artifacts []Artifact `json:"artifacts,omitempty"` // 生成的离线包，包括路径和sha256
+}
+
+// CLIEvent 对应repackage --output json输出的事件
+type CLIEvent struct {
+	Type        string `json:"type"`
+	Stage       string `json:"stage,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	ContainerID string `json:"containerId,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Strategy    string `json:"strategy,omitempty"`
+	Message     string `json:"message,omitempty"`
 }
 
+// ProgressUpdate 任务进度，通过SSE推送给页面
 type ProgressUpdate struct {
 	Stage   string `json:"stage"`
 	Message string `json:"message"`
 	Percent int    `json:"percent"`
 }
 
+// 各阶段开始时的进度百分比
+var stagePercents = map[string]int{
+	"download":     10,
+	"manifest":     20,
+	"unzip":        25,
+	"pip download": 35,
+	"package":      80,
+	"copy-back":    90,
+}
+
 type SystemCapabilities struct {
 	DockerAvailable        bool     `json:"dockerAvailable"`
 	DockerRunning          bool     `json:"dockerRunning"`
@@ -60,7 +90,6 @@ type SystemCapabilities struct {
 	PythonAvailable        bool     `json:"pythonAvailable"`
 	PythonVersion          string   `json:"pythonVersion"`
 	PipAvailable           bool     `json:"pipAvailable"`
-	UnzipAvailable         bool     `json:"unzipAvailable"`
 	NetworkAvailable       bool     `json:"networkAvailable"`
 	RecommendedModes       []string `json:"recommendedModes"`
 	DisabledModes          []string `json:"disabledModes"`
@@ -76,6 +105,13 @@ var (
 func main() {
 	port := getPort()
 
+	// 启动任务队列，每个任务在数据目录中独立的目录中执行，已结束的任务保存到历史记录
+	var err error
+	jobs, err = newJobManager(getDataDir(), getWorkerCount())
+	if err != nil {
+		log.Fatalf("无法加载任务数据: %v", err)
+	}
+
 	// 创建HTTP服务器
 	mux := http.NewServeMux()
 
@@ -88,8 +124,13 @@ func main() {
 	mux.HandleFunc("/api/capabilities", handleCapabilities)
 	mux.HandleFunc("/api/upload", handleUpload)
 	mux.HandleFunc("/api/repackage", handleRepackage)
+	mux.HandleFunc("/api/jobs", handleJobs)
+	mux.HandleFunc("/api/jobs/", handleJob)
+	mux.HandleFunc("/api/history", handleHistory)
+	mux.HandleFunc("/api/history/", handleHistory)
+	mux.HandleFunc("/api/artifacts", handleArtifacts)
+	mux.HandleFunc("/api/artifacts/", handleArtifacts)
 	mux.HandleFunc("/api/status", handleStatus)
-	mux.HandleFunc("/api/download/", handleDownload)
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
@@ -122,6 +163,7 @@ func main() {
 		<-quit
 
 		log.Println("正在关闭服务器...")
+		jobs.shutdown()
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
@@ -195,6 +237,8 @@ func runAsDesktopApp(server *http.Server) {
 			log.Println("应用运行超时，自动退出...")
 		}
 
+		// 停止未完成的任务，避免留下repackage进程和容器内的任务
+		jobs.shutdown()
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
@@ -292,32 +336,15 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// 验证文件扩展名
-	if !strings.HasSuffix(handler.Filename, ".difypkg") {
+	// 文件保存在数据目录中，重新执行历史任务时仍然可用；客户端只拿到uploadId，不接触服务端路径
+	uploadID, err := saveUpload(handler.Filename, file)
+	if err == errInvalidFileName {
 		respondJSON(w, RepackageResponse{
 			Success: false,
-			Error:   "只支持 .difypkg 文件",
+			Error:   err.Error(),
 		})
 		return
 	}
-
-	// 创建临时目录
-	uploadDir := filepath.Join(os.TempDir(), "dify-repackager-uploads")
-	os.MkdirAll(uploadDir, 0755)
-
-	// 保存文件
-	filePath := filepath.Join(uploadDir, handler.Filename)
-	dst, err := os.Create(filePath)
-	if err != nil {
-		respondJSON(w, RepackageResponse{
-			Success: false,
-			Error:   "保存文件失败: " + err.Error(),
-		})
-		return
-	}
-	defer dst.Close()
-
-	_, err = io.Copy(dst, file)
 	if err != nil {
 		respondJSON(w, RepackageResponse{
 			Success: false,
@@ -327,9 +354,10 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondJSON(w, RepackageResponse{
-		Success: true,
-		Message: "文件上传成功",
-		Output:  filePath,
+		Success:  true,
+		Message:  "文件上传成功",
+		Output:   uploadFileName(handler.Filename),
+		UploadID: uploadID,
 	})
 }
 
@@ -348,9 +376,17 @@ func handleRepackage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 执行重新打包
-	result := executeRepackaging(req)
-	respondJSON(w, result)
+	// 兼容同步调用：加入任务队列并等待任务结束
+	job, err := jobs.submit(req)
+	if err != nil {
+		respondJSON(w, RepackageResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	job, _ = jobs.wait(job.ID)
+	respondJSON(w, job.Result)
 }
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -361,71 +397,67 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func handleDownload(w http.ResponseWriter, r *http.Request) {
-	// 从URL路径中获取文件名
-	fileName := strings.TrimPrefix(r.URL.Path, "/api/download/")
-	if fileName == "" {
-		http.Error(w, "文件名不能为空", http.StatusBadRequest)
-		return
-	}
-
-	// 构建文件路径（安全检查）
-	outputDir := filepath.Join(os.TempDir(), "dify-repackager-output")
-	filePath := filepath.Join(outputDir, fileName)
-
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		http.Error(w, "文件不存在", http.StatusNotFound)
-		return
-	}
-
-	// 设置下载头
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
-	w.Header().Set("Content-Type", "application/octet-stream")
-
-	// 发送文件
-	http.ServeFile(w, r, filePath)
-}
-
-func executeRepackaging(req RepackageRequest) RepackageResponse {
-	// 创建输出目录
-	outputDir := filepath.Join(os.TempDir(), "dify-repackager-output")
-	os.MkdirAll(outputDir, 0755)
-
-	// 构建命令参数
-	var args []string
+// 根据请求构建repackage子命令及参数
+func buildRepackageArgs(req RepackageRequest) ([]string, error) {
 	switch req.Mode {
 	case "local":
-		if req.FilePath == "" {
-			return RepackageResponse{
-				Success: false,
-				Error:   "本地模式需要指定文件路径",
-			}
+		if req.UploadID == "" {
+			return nil, fmt.Errorf("本地模式需要先上传文件")
 		}
-		args = []string{"local", req.FilePath}
+		filePath, err := uploadPath(req.UploadID)
+		if err != nil {
+			return nil, err
+		}
+		return []string{"local", filePath}, nil
 
 	case "market":
 		if req.Author == "" || req.Name == "" || req.Version == "" {
-			return RepackageResponse{
-				Success: false,
-				Error:   "市场模式需要指定作者、名称和版本",
-			}
+			return nil, fmt.Errorf("市场模式需要指定作者、名称和版本")
 		}
-		args = []string{"market", req.Author, req.Name, req.Version}
+		if err := validatePathComponents(map[string]string{"作者": req.Author, "名称": req.Name, "版本": req.Version}); err != nil {
+			return nil, err
+		}
+		return []string{"market", req.Author, req.Name, req.Version}, nil
 
 	case "github":
 		if req.Repository == "" || req.Release == "" || req.Asset == "" {
-			return RepackageResponse{
-				Success: false,
-				Error:   "GitHub模式需要指定仓库、发布版本和资源名称",
-			}
+			return nil, fmt.Errorf("GitHub模式需要指定仓库、发布版本和资源名称")
+		}
+		if err := validatePathComponents(map[string]string{"发布版本": req.Release, "资源名称": req.Asset}); err != nil {
+			return nil, err
+		}
+		// 仓库为owner/repo或完整URL，允许/，但不能包含\和..
+		if strings.Contains(req.Repository, `\`) || strings.Contains(req.Repository, "..") {
+			return nil, fmt.Errorf("仓库不能包含\\或..: %s", req.Repository)
 		}
-		args = []string{"github", req.Repository, req.Release, req.Asset}
+		return []string{"github", req.Repository, req.Release, req.Asset}, nil
 
 	default:
+		return nil, fmt.Errorf("不支持的模式: %s", req.Mode)
+	}
+}
+
+// 市场和GitHub参数会拼接到下载地址和文件名中，不能包含路径分隔符和..
+func validatePathComponents(fields map[string]string) error {
+	for label, value := range fields {
+		if strings.ContainsAny(value, `/\`) || strings.Contains(value, "..") {
+			return fmt.Errorf("%s不能包含/、\\或..: %s", label, value)
+		}
+	}
+	return nil
+}
+
+// 取消任务后等待repackage自行停止和清理的时间，超时后强制终止进程树
+const cancelGracePeriod = 30 * time.Second
+
+// 在任务的工作目录中执行repackage，离线包写入outputDir，每行输出和阶段变化通过progress回调；ctx取消时停止repackage
+func executeRepackaging(ctx context.Context, req RepackageRequest, workDir, outputDir string, progress func(ProgressUpdate)) RepackageResponse {
+	// 构建命令参数
+	args, err := buildRepackageArgs(req)
+	if err != nil {
 		return RepackageResponse{
 			Success: false,
-			Error:   "不支持的模式: " + req.Mode,
+			Error:   err.Error(),
 		}
 	}
 
@@ -438,27 +470,15 @@ func executeRepackaging(req RepackageRequest) RepackageResponse {
 		}
 	}
 
-	// 执行命令
-	cmd := exec.Command(repackagePath, args...)
-	cmd.Dir = outputDir
+	// 根据用户选择的执行环境设置--exec参数，GUI中无法交互，始终使用--yes
+	execMode := executionToExecMode(req.Execution)
+	log.Printf("🔍 执行环境: %s -> --exec=%s", req.Execution, execMode)
 
-	// 根据用户选择的执行环境设置环境变量
-	cmd.Env = os.Environ()
-	switch req.Execution {
-	case "local":
-		// 强制本地执行
-		cmd.Env = append(cmd.Env, "FORCE_LOCAL_EXECUTION=true")
-		log.Printf("🖥️ 用户选择本地执行环境")
-	case "docker":
-		// 优先使用Docker（默认行为）
-		log.Printf("🐳 用户选择Docker容器执行环境")
-	case "new-docker":
-		// 创建新Docker环境（暂时使用现有Docker逻辑）
-		log.Printf("🆕 用户选择新建Docker执行环境")
-	default:
-		// 默认行为：自动检测
-		log.Printf("🔍 自动检测执行环境")
-	}
+	// 执行命令，使用结构化输出获取执行结果，离线包直接写入输出目录
+	args = append([]string{"--output", "json", "--exec", execMode, "--yes", "--output-dir", outputDir}, args...)
+	cmd := exec.Command(repackagePath, args...)
+	cmd.Dir = workDir
+	setProcessGroup(cmd)
 
 	// 启动命令并获取实时输出
 	stdout, err := cmd.StdoutPipe()
@@ -484,30 +504,89 @@ func executeRepackaging(req RepackageRequest) RepackageResponse {
 		}
 	}
 
-	// 收集输出
-	var outputBuffer strings.Builder
+	// 取消任务时先中断repackage，由其终止pip和容器内的任务并清理工作目录，超时后终止整个进程树
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-exited:
+			return
+		}
+		log.Printf("⏹️ 正在停止repackage (pid %d)", cmd.Process.Pid)
+		if err := interruptProcess(cmd.Process); err != nil {
+			log.Printf("中断repackage失败: %v", err)
+		}
+		select {
+		case <-exited:
+		case <-time.After(cancelGracePeriod):
+			log.Printf("⏹️ repackage未在%s内退出，强制终止进程树", cancelGracePeriod)
+			killProcessTree(cmd.Process)
+		}
+	}()
 
-	// 读取stdout
+	// 收集输出：标准输出为事件，标准错误为日志
+	var (
+		outputBuffer strings.Builder
+		outputMu     sync.Mutex
+		artifacts    []CLIEvent
+		wg           sync.WaitGroup
+	)
+	appendOutput := func(line string) {
+		outputMu.Lock()
+		outputBuffer.WriteString(line + "\n")
+		outputMu.Unlock()
+		progress(ProgressUpdate{Message: line})
+	}
+
+	wg.Add(2)
+
+	// 读取stdout中的事件
 	go func() {
+		defer wg.Done()
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
 			line := scanner.Text()
-			outputBuffer.WriteString(line + "\n")
-			log.Printf("📋 CLI输出: %s", line)
+			var event CLIEvent
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				appendOutput(line)
+				continue
+			}
+
+			log.Printf("📋 CLI事件: %s", line)
+			switch event.Type {
+			case "stage":
+				outputMu.Lock()
+				outputBuffer.WriteString("==> " + event.Stage + "\n")
+				outputMu.Unlock()
+				progress(ProgressUpdate{Stage: event.Stage, Message: "==> " + event.Stage, Percent: stagePercents[event.Stage]})
+			case "environment":
+				appendOutput("执行环境: " + event.Environment)
+			case "dependencies":
+				appendOutput("依赖来源: " + event.Strategy)
+			case "artifact":
+				outputMu.Lock()
+				artifacts = append(artifacts, event)
+				outputMu.Unlock()
+			case "error":
+				appendOutput("错误: " + event.Message)
+			}
 		}
 	}()
 
-	// 读取stderr
+	// 读取stderr中的日志
 	go func() {
+		defer wg.Done()
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
 			line := scanner.Text()
-			outputBuffer.WriteString(line + "\n")
-			log.Printf("⚠️ CLI错误: %s", line)
+			appendOutput(line)
+			log.Printf("📋 CLI输出: %s", line)
 		}
 	}()
 
-	// 等待命令完成
+	// 等待输出读取完毕后再等待命令结束
+	wg.Wait()
 	err = cmd.Wait()
 	output := outputBuffer.String()
 
@@ -519,13 +598,42 @@ func executeRepackaging(req RepackageRequest) RepackageResponse {
 		}
 	}
 
-	// 查找生成的文件
-	outputFiles := findOutputFiles(outputDir)
+	// 使用CLI报告的离线包
+	var (
+		files, summaries []string
+		results          []Artifact
+	)
+	for _, artifact := range artifacts {
+		name := filepath.Base(artifact.Path)
+		files = append(files, name)
+		summaries = append(summaries, fmt.Sprintf("%s (sha256: %s)", name, artifact.SHA256))
+		results = append(results, Artifact{Name: name, Path: artifact.Path, Size: artifact.Size, SHA256: artifact.SHA256})
+	}
 
 	return RepackageResponse{
-		Success: true,
-		Message: "重新打包成功",
-		Output:  string(output) + "\n\n生成的文件: " + strings.Join(outputFiles, ", "),
+		Success:   true,
+		Message:   "重新打包成功",
+		Output:    output + "\n\n生成的文件: " + strings.Join(summaries, ", "),
+		Files:     files,
+		Artifacts: results,
+	}
+}
+
+// 将GUI中的执行环境选项转换为repackage的--exec参数
+func executionToExecMode(execution string) string {
+	switch execution {
+	case "local":
+		// 强制本地执行
+		return "local"
+	case "docker":
+		// 使用已有的插件容器
+		return "container"
+	case "new-docker":
+		// 启动一次性容器执行，结束后自动删除
+		return "ephemeral"
+	default:
+		// 默认行为：自动检测
+		return "auto"
 	}
 }
 
@@ -566,7 +674,8 @@ func findRepackageExecutable() string {
 	log.Printf("🔍 搜索repackage可执行文件，路径列表:")
 	for _, path := range possiblePaths {
 		log.Printf("  - 检查: %s", path)
-		if _, err := os.Stat(path); err == nil {
+		// 源码目录中的../repackage是CLI的目录，只接受普通文件
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
 			absPath, _ := filepath.Abs(path)
 			log.Printf("✅ 找到repackage: %s", absPath)
 			return absPath
@@ -583,24 +692,6 @@ func findRepackageExecutable() string {
 	return ""
 }
 
-func findOutputFiles(dir string) []string {
-	var files []string
-
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-
-		if !info.IsDir() && strings.HasSuffix(info.Name(), "-offline.difypkg") {
-			files = append(files, info.Name())
-		}
-
-		return nil
-	})
-
-	return files
-}
-
 func handleCapabilities(w http.ResponseWriter, r *http.Request) {
 	capabilities := detectSystemCapabilities()
 	respondJSON(w, capabilities)
@@ -628,9 +719,6 @@ func detectSystemCapabilities() SystemCapabilities {
 	// 检测pip
 	capabilities.PipAvailable = isPipAvailable()
 
-	// 检测unzip
-	capabilities.UnzipAvailable = isUnzipAvailable()
-
 	// 检测网络连接
 	capabilities.NetworkAvailable = isNetworkAvailable()
 
@@ -638,7 +726,7 @@ func detectSystemCapabilities() SystemCapabilities {
 	if capabilities.DockerAvailable && capabilities.DockerRunning {
 		capabilities.RecommendedModes = append(capabilities.RecommendedModes, "local", "market", "github")
 		capabilities.WarningMessages = append(capabilities.WarningMessages, "✅ Docker环境可用，推荐使用所有模式")
-	} else if capabilities.PythonAvailable && capabilities.PipAvailable && capabilities.UnzipAvailable {
+	} else if capabilities.PythonAvailable && capabilities.PipAvailable {
 		capabilities.RecommendedModes = append(capabilities.RecommendedModes, "local")
 		if capabilities.NetworkAvailable {
 			capabilities.RecommendedModes = append(capabilities.RecommendedModes, "market", "github")
@@ -656,9 +744,6 @@ func detectSystemCapabilities() SystemCapabilities {
 		if !capabilities.PipAvailable {
 			capabilities.WarningMessages = append(capabilities.WarningMessages, "❌ 未检测到pip包管理器")
 		}
-		if !capabilities.UnzipAvailable {
-			capabilities.WarningMessages = append(capabilities.WarningMessages, "❌ 未检测到unzip工具")
-		}
 
 		if capabilities.DockerAvailable {
 			capabilities.WarningMessages = append(capabilities.WarningMessages, "💡 检测到Docker已安装，请启动Docker服务")
@@ -790,11 +875,6 @@ func isPipAvailable() bool {
 	return false
 }
 
-func isUnzipAvailable() bool {
-	cmd := exec.Command("unzip", "-v")
-	return cmd.Run() == nil
-}
-
 func isNetworkAvailable() bool {
 	const maxTries = 3
 
@@ -816,3 +896,9 @@ func respondJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
+
+func respondJSONStatus(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestBuildRepackageArgsRejectsPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		req  RepackageRequest
+	}{
+		{"market author", RepackageRequest{Mode: "market", Author: "../../tmp", Name: "agent", Version: "0.0.9"}},
+		{"market name", RepackageRequest{Mode: "market", Author: "langgenius", Name: `..\evil`, Version: "0.0.9"}},
+		{"market version", RepackageRequest{Mode: "market", Author: "langgenius", Name: "agent", Version: "0.0.9/../../x"}},
+		{"github release", RepackageRequest{Mode: "github", Repository: "owner/repo", Release: "../v1", Asset: "plugin.difypkg"}},
+		{"github asset", RepackageRequest{Mode: "github", Repository: "owner/repo", Release: "v1", Asset: "../../plugin.difypkg"}},
+		{"github repository", RepackageRequest{Mode: "github", Repository: "owner/../../repo", Release: "v1", Asset: "plugin.difypkg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if args, err := buildRepackageArgs(tt.req); err == nil {
+				t.Errorf("expected an error, got args %q", args)
+			}
+		})
+	}
+}
+
+func TestBuildRepackageArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		req  RepackageRequest
+		want []string
+	}{
+		{"market", RepackageRequest{Mode: "market", Author: "langgenius", Name: "agent", Version: "0.0.9"}, []string{"market", "langgenius", "agent", "0.0.9"}},
+		{"github", RepackageRequest{Mode: "github", Repository: "https://github.com/owner/repo", Release: "v1.0.0", Asset: "plugin.difypkg"}, []string{"github", "https://github.com/owner/repo", "v1.0.0", "plugin.difypkg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := buildRepackageArgs(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(args) != len(tt.want) {
+				t.Fatalf("got %q, want %q", args, tt.want)
+			}
+			for i := range args {
+				if args[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", args, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// 在独立的进程组中启动repackage，取消任务时可以连同其启动的pip、docker等子进程一起终止
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// 请求repackage停止，由其终止子进程和容器内的任务并清理工作目录
+func interruptProcess(p *os.Process) error {
+	return p.Signal(os.Interrupt)
+}
+
+// 强制终止整个进程组
+func killProcessTree(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
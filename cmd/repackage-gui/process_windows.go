@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+	procAttachConsole            = kernel32.NewProc("AttachConsole")
+	procFreeConsole              = kernel32.NewProc("FreeConsole")
+
+	// 同一时间只能附加到一个控制台
+	consoleMu sync.Mutex
+)
+
+// 在新的进程组中启动repackage，取消任务时可以只向它发送Ctrl+Break
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// 向repackage的进程组发送Ctrl+Break，repackage将其作为中断处理，终止子进程和容器内的任务并清理工作目录
+func interruptProcess(p *os.Process) error {
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+
+	if sendCtrlBreak(p.Pid) == nil {
+		return nil
+	}
+
+	// 以windowsgui方式构建时GUI没有控制台，先附加到repackage的控制台再发送
+	if r, _, err := procAttachConsole.Call(uintptr(p.Pid)); r == 0 {
+		return fmt.Errorf("AttachConsole: %v", err)
+	}
+	defer procFreeConsole.Call()
+	return sendCtrlBreak(p.Pid)
+}
+
+// 向以pid为进程组ID的进程组发送Ctrl+Break
+func sendCtrlBreak(pid int) error {
+	if r, _, err := procGenerateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(pid)); r == 0 {
+		return fmt.Errorf("GenerateConsoleCtrlEvent: %v", err)
+	}
+	return nil
+}
+
+// 用taskkill终止进程及其所有子进程
+func killProcessTree(p *os.Process) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run()
+}
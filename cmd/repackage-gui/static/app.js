@@ -1,8 +1,11 @@
 // 全局变量
 let currentMode = 'local';
 let currentExecution = 'docker';
-let uploadedFilePath = '';
+let uploadedFileId = '';
 let currentDownloadFile = '';
+let currentArtifactId = '';
+let currentJobId = '';
+let jobEventSource = null;
 let systemCapabilities = null;
 
 // DOM 元素
@@ -28,19 +31,24 @@ const elements = {
     downloadBtn: document.getElementById('download-btn'),
     newTaskBtn: document.getElementById('new-task-btn'),
     retryBtn: document.getElementById('retry-btn'),
+    cancelBtn: document.getElementById('cancel-btn'),
     // 表单输入
     marketAuthor: document.getElementById('market-author'),
     marketName: document.getElementById('market-name'),
     marketVersion: document.getElementById('market-version'),
     githubRepo: document.getElementById('github-repo'),
     githubRelease: document.getElementById('github-release'),
-    githubAsset: document.getElementById('github-asset')
+    githubAsset: document.getElementById('github-asset'),
+    jobList: document.getElementById('job-list'),
+    artifactList: document.getElementById('artifact-list')
 };
 
 // 初始化
 document.addEventListener('DOMContentLoaded', function() {
     initializeEventListeners();
     loadSystemCapabilities();
+    loadJobs();
+    loadArtifacts();
 });
 
 // 事件监听器
@@ -73,8 +81,9 @@ function initializeEventListeners() {
     // 按钮事件
     elements.repackageBtn.addEventListener('click', startRepackaging);
     elements.downloadBtn.addEventListener('click', downloadResult);
-    elements.newTaskBtn.addEventListener('click', resetForm);
+    elements.newTaskBtn.addEventListener('click', startNewTask);
     elements.retryBtn.addEventListener('click', startRepackaging);
+    elements.cancelBtn.addEventListener('click', cancelJob);
 
     // 表单验证
     [elements.marketAuthor, elements.marketName, elements.marketVersion].forEach(input => {
@@ -204,7 +213,7 @@ function uploadFile(file) {
     .then(response => response.json())
     .then(data => {
         if (data.success) {
-            uploadedFilePath = data.output;
+            uploadedFileId = data.uploadId;
             updateProgress('文件上传成功', 20);
             setTimeout(() => hideProgress(), 1000);
         } else {
@@ -239,8 +248,8 @@ function startRepackaging() {
     showProgress('开始处理...', 0);
     elements.repackageBtn.disabled = true;
     
-    // 发送请求
-    fetch('/api/repackage', {
+    // 创建任务，服务端立即返回任务ID，之后通过SSE接收进度
+    fetch('/api/jobs', {
         method: 'POST',
         headers: {
             'Content-Type': 'application/json'
@@ -249,14 +258,12 @@ function startRepackaging() {
     })
     .then(response => response.json())
     .then(data => {
-        elements.repackageBtn.disabled = false;
-        hideProgress();
-        
-        if (data.success) {
-            showSuccess(data.message, data.output);
-        } else {
-            showError(data.error || '处理失败', data.output);
+        if (!data.id) {
+            throw new Error(data.error || '创建任务失败');
         }
+        watchJob(data.id);
+        addLog('任务已创建: ' + data.id);
+        loadJobs();
     })
     .catch(error => {
         elements.repackageBtn.disabled = false;
@@ -265,6 +272,280 @@ function startRepackaging() {
     });
 }
 
+// 各阶段的显示名称
+const stageLabels = {
+    'download': '下载插件',
+    'manifest': '读取插件清单',
+    'unzip': '解压插件',
+    'pip download': '下载依赖',
+    'package': '重新打包',
+    'copy-back': '复制离线包'
+};
+
+// 跟踪任务直到结束，任务ID保存在localStorage中，刷新页面后可以继续跟踪
+function watchJob(jobId) {
+    stopWatching();
+    currentJobId = jobId;
+    localStorage.setItem('currentJobId', jobId);
+    elements.progressLog.textContent = '';
+    showProgress('排队中...', 0);
+    elements.repackageBtn.disabled = true;
+    elements.cancelBtn.style.display = 'inline-block';
+    elements.cancelBtn.disabled = false;
+
+    // 服务端先重放已有的事件，再实时推送阶段变化和每行输出
+    const source = new EventSource('/api/jobs/' + encodeURIComponent(jobId) + '/events');
+    jobEventSource = source;
+    source.addEventListener('stage', e => {
+        const update = JSON.parse(e.data);
+        updateProgress(stageLabels[update.stage] || update.stage, update.percent);
+    });
+    source.addEventListener('log', e => {
+        addLog(JSON.parse(e.data).message);
+    });
+    source.addEventListener('done', e => {
+        stopWatching();
+        showJobResult(JSON.parse(e.data));
+        loadJobs();
+        loadArtifacts();
+    });
+    source.onerror = () => {
+        // 连接中断时浏览器会自动重连，任务不存在时连接直接关闭
+        if (source.readyState === EventSource.CLOSED) {
+            stopWatching();
+            localStorage.removeItem('currentJobId');
+            elements.repackageBtn.disabled = false;
+            hideProgress();
+            showError('无法获取任务进度: ' + jobId);
+        }
+    };
+}
+
+function stopWatching() {
+    elements.cancelBtn.style.display = 'none';
+    if (jobEventSource) {
+        jobEventSource.close();
+        jobEventSource = null;
+    }
+}
+
+// 取消当前任务，任务结束后通过done事件显示结果
+function cancelJob() {
+    if (!currentJobId || !confirm('确定要取消当前任务吗？')) {
+        return;
+    }
+    elements.cancelBtn.disabled = true;
+    addLog('正在取消任务...');
+
+    fetch('/api/jobs/' + encodeURIComponent(currentJobId), { method: 'DELETE' })
+    .then(response => response.json())
+    .then(data => {
+        if (data.error) {
+            addLog('取消失败: ' + data.error);
+        }
+    })
+    .catch(error => {
+        elements.cancelBtn.disabled = false;
+        addLog('取消失败: ' + error.message);
+    });
+}
+
+// 页面加载时继续跟踪上次的任务
+function resumeJob() {
+    const jobId = localStorage.getItem('currentJobId');
+    if (jobId) {
+        watchJob(jobId);
+    }
+}
+
+// 显示已结束任务的结果，日志已经实时显示，这里只显示结果
+function showJobResult(job) {
+    currentJobId = job.id;
+    elements.repackageBtn.disabled = false;
+    hideResults();
+
+    const result = job.result || {};
+    currentArtifactId = (result.artifacts && result.artifacts.length > 0) ? result.artifacts[0].id : '';
+    if (job.state === 'succeeded') {
+        updateProgress('完成', 100);
+        showSuccess(result.message, result.output, result.files);
+    } else if (job.state === 'canceled') {
+        updateProgress('已取消', 0);
+        showError('任务已取消');
+        elements.errorDetails.textContent = result.output || '';
+    } else {
+        showError(result.error || '处理失败');
+        elements.errorDetails.textContent = result.output || '';
+    }
+}
+
+// 加载任务列表
+function loadJobs() {
+    fetch('/api/jobs')
+    .then(response => response.json())
+    .then(renderJobs)
+    .catch(error => console.error('加载任务列表失败:', error));
+}
+
+function renderJobs(jobs) {
+    if (!jobs || jobs.length === 0) {
+        elements.jobList.innerHTML = '<div class="list-group-item small text-muted">暂无任务</div>';
+        return;
+    }
+
+    const badges = {
+        queued: '<span class="badge bg-secondary">排队中</span>',
+        running: '<span class="badge bg-primary">处理中</span>',
+        succeeded: '<span class="badge bg-success">成功</span>',
+        failed: '<span class="badge bg-danger">失败</span>',
+        canceled: '<span class="badge bg-warning text-dark">已取消</span>'
+    };
+    const executions = {
+        local: '本地',
+        docker: 'Docker容器',
+        'new-docker': '新建Docker环境'
+    };
+    const finished = ['succeeded', 'failed', 'canceled'];
+    elements.jobList.innerHTML = '';
+    jobs.forEach(job => {
+        const item = document.createElement('div');
+        item.className = 'list-group-item list-group-item-action d-flex justify-content-between align-items-center small';
+        item.style.cursor = 'pointer';
+
+        let details = executions[job.request.execution] || '自动';
+        if (job.duration) {
+            details += ` · ${formatDuration(job.duration)}`;
+        }
+        item.innerHTML = `<span><code>${job.id}</code> ${escapeHTML(describeJob(job.request))}
+            <span class="text-muted">(${details})</span></span>
+            <span class="text-nowrap">${badges[job.state] || ''}</span>`;
+        item.addEventListener('click', () => openJob(job));
+
+        // 已结束的任务可以重新执行或删除
+        if (finished.includes(job.state)) {
+            const actions = item.lastElementChild;
+            actions.appendChild(actionButton('bi-arrow-repeat', '使用相同参数重新执行', () => rerunJob(job.id)));
+            actions.appendChild(actionButton('bi-trash', '删除任务及其离线包', () => deleteJob(job.id)));
+        }
+        elements.jobList.appendChild(item);
+    });
+}
+
+// 列表项中的操作按钮，点击时不触发列表项本身的点击事件
+function actionButton(icon, title, onClick) {
+    const button = document.createElement('button');
+    button.type = 'button';
+    button.className = 'btn btn-sm btn-link p-0 ms-2';
+    button.title = title;
+    button.innerHTML = `<i class="bi ${icon}"></i>`;
+    button.addEventListener('click', e => {
+        e.stopPropagation();
+        onClick();
+    });
+    return button;
+}
+
+// 使用历史任务的参数重新执行
+function rerunJob(jobId) {
+    hideResults();
+    fetch('/api/history/' + encodeURIComponent(jobId) + '/rerun', { method: 'POST' })
+    .then(response => response.json())
+    .then(data => {
+        if (!data.id) {
+            throw new Error(data.error || '重新执行失败');
+        }
+        watchJob(data.id);
+        addLog('重新执行任务 ' + jobId + '，新任务: ' + data.id);
+        loadJobs();
+    })
+    .catch(error => showError('重新执行失败: ' + error.message));
+}
+
+// 删除历史任务及其离线包
+function deleteJob(jobId) {
+    if (!confirm('确定要删除该任务及其生成的离线包吗？')) {
+        return;
+    }
+    fetch('/api/history/' + encodeURIComponent(jobId), { method: 'DELETE' })
+    .then(response => response.json())
+    .then(data => {
+        if (!data.success) {
+            throw new Error(data.error || '删除失败');
+        }
+        if (jobId === currentJobId) {
+            startNewTask();
+        }
+        loadJobs();
+        loadArtifacts();
+    })
+    .catch(error => showError('删除任务失败: ' + error.message));
+}
+
+// 加载离线包列表
+function loadArtifacts() {
+    fetch('/api/artifacts')
+    .then(response => response.json())
+    .then(renderArtifacts)
+    .catch(error => console.error('加载离线包列表失败:', error));
+}
+
+function renderArtifacts(artifacts) {
+    if (!artifacts || artifacts.length === 0) {
+        elements.artifactList.innerHTML = '<div class="list-group-item small text-muted">暂无离线包</div>';
+        return;
+    }
+
+    elements.artifactList.innerHTML = '';
+    artifacts.forEach(artifact => {
+        const item = document.createElement('div');
+        item.className = 'list-group-item d-flex justify-content-between align-items-center small';
+        item.innerHTML = `<span><i class="bi bi-file-earmark-zip"></i> ${escapeHTML(artifact.name)}
+            <span class="text-muted">(${formatFileSize(artifact.size)}, sha256: <code title="${artifact.sha256}">${artifact.sha256.substring(0, 12)}</code>)</span></span>
+            <span class="text-nowrap"></span>`;
+        const actions = item.lastElementChild;
+        actions.appendChild(actionButton('bi-download', '下载', () => downloadArtifact(artifact.id, artifact.name)));
+        actions.appendChild(actionButton('bi-trash', '删除', () => deleteArtifact(artifact.id)));
+        elements.artifactList.appendChild(item);
+    });
+}
+
+// 删除离线包
+function deleteArtifact(artifactId) {
+    if (!confirm('确定要删除该离线包吗？')) {
+        return;
+    }
+    fetch('/api/artifacts/' + encodeURIComponent(artifactId), { method: 'DELETE' })
+    .then(response => response.json())
+    .then(data => {
+        if (!data.success) {
+            throw new Error(data.error || '删除失败');
+        }
+        loadArtifacts();
+        loadJobs();
+    })
+    .catch(error => showError('删除离线包失败: ' + error.message));
+}
+
+// 打开任务：重放任务的日志，未结束的任务继续跟踪
+function openJob(job) {
+    hideResults();
+    watchJob(job.id);
+}
+
+// 任务来源的简要描述
+function describeJob(request) {
+    switch (request.mode) {
+        case 'local':
+            return request.fileName;
+        case 'market':
+            return `${request.author}/${request.name}@${request.version}`;
+        case 'github':
+            return `${request.repository}@${request.release} ${request.asset}`;
+        default:
+            return request.mode;
+    }
+}
+
 // 构建请求数据
 function buildRequestData() {
     const data = { 
@@ -274,7 +555,7 @@ function buildRequestData() {
     
     switch (currentMode) {
         case 'local':
-            data.filePath = uploadedFilePath;
+            data.uploadId = uploadedFileId;
             break;
         case 'market':
             data.author = elements.marketAuthor.value.trim();
@@ -295,7 +576,7 @@ function buildRequestData() {
 function validateForm() {
     switch (currentMode) {
         case 'local':
-            if (!uploadedFilePath) {
+            if (!uploadedFileId) {
                 showError('请先上传 .difypkg 文件');
                 return false;
             }
@@ -414,14 +695,14 @@ function showProgress(stage, percent) {
 }
 
 function updateProgress(stage, percent) {
-    elements.progressStage.textContent = stage;
-    elements.progressBar.style.width = percent + '%';
-    elements.progressBar.setAttribute('aria-valuenow', percent);
-    
-    // 添加日志
+    // 阶段变化时添加日志
     if (stage && stage !== elements.progressStage.textContent) {
         addLog(stage);
     }
+
+    elements.progressStage.textContent = stage;
+    elements.progressBar.style.width = percent + '%';
+    elements.progressBar.setAttribute('aria-valuenow', percent);
 }
 
 function hideProgress() {
@@ -446,14 +727,14 @@ function addLog(message) {
 }
 
 // 结果显示
-function showSuccess(message, output) {
+function showSuccess(message, output, outputFiles) {
     elements.resultSection.style.display = 'block';
     elements.resultSection.classList.add('fade-in');
     elements.resultSuccess.style.display = 'block';
     elements.resultError.style.display = 'none';
     
-    // 解析输出中的文件名
-    const files = parseOutputFiles(output);
+    // 优先使用CLI报告的文件名，旧版本CLI则解析输出
+    const files = (outputFiles && outputFiles.length > 0) ? outputFiles : parseOutputFiles(output);
     if (files.length > 0) {
         currentDownloadFile = files[0];
         elements.resultFiles.innerHTML = files.map(file => 
@@ -461,9 +742,7 @@ function showSuccess(message, output) {
         ).join('');
     }
     
-    // 显示完整输出
     addLog('处理完成');
-    addLog(output);
 }
 
 function showError(message, details = '') {
@@ -500,16 +779,29 @@ function parseOutputFiles(output) {
 
 // 下载结果
 function downloadResult() {
-    if (currentDownloadFile) {
-        const link = document.createElement('a');
-        link.href = '/api/download/' + encodeURIComponent(currentDownloadFile);
-        link.download = currentDownloadFile;
-        document.body.appendChild(link);
-        link.click();
-        document.body.removeChild(link);
+    if (currentArtifactId) {
+        downloadArtifact(currentArtifactId, currentDownloadFile);
     }
 }
 
+// 按ID下载离线包
+function downloadArtifact(artifactId, fileName) {
+    const link = document.createElement('a');
+    link.href = '/api/artifacts/' + encodeURIComponent(artifactId);
+    link.download = fileName;
+    document.body.appendChild(link);
+    link.click();
+    document.body.removeChild(link);
+}
+
+// 开始新任务，不再跟踪当前任务
+function startNewTask() {
+    currentJobId = '';
+    stopWatching();
+    localStorage.removeItem('currentJobId');
+    resetForm();
+}
+
 // 重置表单
 function resetForm() {
     // 隐藏结果和进度
@@ -518,8 +810,9 @@ function resetForm() {
     elements.fileInfo.style.display = 'none';
     
     // 清空文件上传
-    uploadedFilePath = '';
+    uploadedFileId = '';
     currentDownloadFile = '';
+    currentArtifactId = '';
     elements.fileInput.value = '';
     
     // 清空表单
@@ -551,6 +844,19 @@ function formatFileSize(bytes) {
     return parseFloat((bytes / Math.pow(k, i)).toFixed(2)) + ' ' + sizes[i];
 }
 
+function formatDuration(seconds) {
+    if (seconds < 60) {
+        return Math.round(seconds) + '秒';
+    }
+    return Math.floor(seconds / 60) + '分' + Math.round(seconds % 60) + '秒';
+}
+
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
 // 错误处理
 window.addEventListener('error', function(e) {
     console.error('JavaScript错误:', e.error);
@@ -576,6 +882,10 @@ function loadSystemCapabilities() {
             showSystemError('系统环境检测失败，部分功能可能不可用');
             // 使用默认配置
             switchMode('local');
+        })
+        .finally(() => {
+            // 选择默认模式会重置表单，之后再恢复上次的任务
+            resumeJob();
         });
 }
 
@@ -651,10 +961,6 @@ function showSystemStatus() {
                 </div>
             </div>
             <div class="col-md-6">
-                <div class="mb-1">
-                    <i class="bi bi-${systemCapabilities.unzipAvailable ? 'check-circle text-success' : 'x-circle text-danger'}"></i>
-                    unzip: ${systemCapabilities.unzipAvailable ? '可用' : '不可用'}
-                </div>
                 <div class="mb-1">
                     <i class="bi bi-${systemCapabilities.networkAvailable ? 'check-circle text-success' : 'x-circle text-danger'}"></i>
                     网络连接: ${systemCapabilities.networkAvailable ? '正常' : '不可用'}
@@ -757,11 +1063,3 @@ function showSystemError(message) {
     const mainCard = document.querySelector('.card');
     mainCard.parentNode.insertBefore(errorDiv, mainCard);
 }
-
-// 页面卸载前确认
-window.addEventListener('beforeunload', function(e) {
-    if (elements.progressSection.style.display !== 'none') {
-        e.preventDefault();
-        e.returnValue = '正在处理中，确定要离开吗？';
-    }
-}); 
\ No newline at end of file
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	errInvalidFileName = errors.New("只支持 .difypkg 文件")
+	errUploadNotFound  = errors.New("上传的文件已不存在，请重新上传")
+	errOutsideDataDir  = errors.New("路径不在数据目录中")
+)
+
+// 服务端生成的任务、上传和离线包ID只包含字母、数字和连字符
+var idPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// 上传的文件保存在数据目录的uploads/{uploadId}/下，任务只能通过uploadId引用上传的文件
+func getUploadDir() string {
+	return filepath.Join(getDataDir(), "uploads")
+}
+
+// 保存上传的文件并返回生成的uploadId，保留原文件名是因为离线包按它命名
+func saveUpload(fileName string, src io.Reader) (string, error) {
+	name := uploadFileName(fileName)
+	if !strings.HasSuffix(name, ".difypkg") {
+		return "", errInvalidFileName
+	}
+
+	id := newJobID()
+	dir := filepath.Join(getUploadDir(), id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dst, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return id, nil
+}
+
+// 客户端提供的文件名只取最后一段，Windows的路径分隔符同样处理
+func uploadFileName(fileName string) string {
+	name := path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// 根据uploadId找到上传的文件
+func uploadPath(id string) (string, error) {
+	if !idPattern.MatchString(id) {
+		return "", errUploadNotFound
+	}
+	dir, err := containedPath(getUploadDir(), id)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", errUploadNotFound
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".difypkg") {
+			return filepath.Join(dir, entry.Name()), nil
+		}
+	}
+	return "", errUploadNotFound
+}
+
+// 返回base中的路径，相对路径基于base解析，不在base之内时返回errOutsideDataDir
+func containedPath(base, target string) (string, error) {
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(base, target)
+	}
+	target = filepath.Clean(target)
+
+	rel, err := filepath.Rel(base, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideDataDir
+	}
+	return target, nil
+}
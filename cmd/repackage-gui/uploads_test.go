@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 使用临时数据目录创建不执行任务的jobManager
+func setupDataDir(t *testing.T) string {
+	t.Helper()
+	dataDir := filepath.Join(t.TempDir(), "data")
+	t.Setenv("REPACKAGE_GUI_DATA_DIR", dataDir)
+
+	m, err := newJobManager(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs = m
+	return dataDir
+}
+
+func upload(t *testing.T, fileName string) RepackageResponse {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("payload"))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handleUpload(rec, req)
+
+	var resp RepackageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestUploadFileName(t *testing.T) {
+	tests := map[string]string{
+		"plugin.difypkg":                  "plugin.difypkg",
+		"../../evil.difypkg":              "evil.difypkg",
+		"/etc/cron.d/evil.difypkg":        "evil.difypkg",
+		`..\..\evil.difypkg`:              "evil.difypkg",
+		`C:\Windows\Temp\evil.difypkg`:    "evil.difypkg",
+		"..":                              "",
+		"/":                               "",
+		"uploads/../../../evil.difypkg/.": "",
+	}
+	for fileName, want := range tests {
+		if got := uploadFileName(fileName); got != want {
+			t.Errorf("uploadFileName(%q) = %q, want %q", fileName, got, want)
+		}
+	}
+}
+
+func TestUploadTraversal(t *testing.T) {
+	dataDir := setupDataDir(t)
+
+	for _, fileName := range []string{
+		"../../evil.difypkg",
+		`..\..\evil.difypkg`,
+		filepath.Join(filepath.Dir(dataDir), "evil.difypkg"),
+	} {
+		resp := upload(t, fileName)
+		if !resp.Success {
+			t.Fatalf("upload %q failed: %s", fileName, resp.Error)
+		}
+		if strings.Contains(resp.Output, "/") || strings.Contains(resp.Output, dataDir) {
+			t.Errorf("upload %q exposed a path: %q", fileName, resp.Output)
+		}
+
+		filePath, err := uploadPath(resp.UploadID)
+		if err != nil {
+			t.Fatalf("upload %q: %v", fileName, err)
+		}
+		if want := filepath.Join(getUploadDir(), resp.UploadID, "evil.difypkg"); filePath != want {
+			t.Errorf("upload %q saved to %s, want %s", fileName, filePath, want)
+		}
+	}
+
+	// 数据目录之外不能出现上传的文件
+	for _, dir := range []string{filepath.Dir(dataDir), dataDir, getUploadDir()} {
+		if _, err := os.Stat(filepath.Join(dir, "evil.difypkg")); !os.IsNotExist(err) {
+			t.Errorf("upload escaped to %s", dir)
+		}
+	}
+}
+
+func TestUploadRejectsOtherExtensions(t *testing.T) {
+	setupDataDir(t)
+
+	for _, fileName := range []string{"evil.sh", "evil.difypkg/..", ".."} {
+		if resp := upload(t, fileName); resp.Success {
+			t.Errorf("upload %q was accepted", fileName)
+		}
+	}
+}
+
+func TestUploadPathRejectsTraversal(t *testing.T) {
+	dataDir := setupDataDir(t)
+
+	// 数据目录旁边放一个文件，确认无法通过uploadId引用
+	outside := filepath.Join(filepath.Dir(dataDir), "secret")
+	os.MkdirAll(outside, 0755)
+	os.WriteFile(filepath.Join(outside, "secret.difypkg"), []byte("secret"), 0644)
+
+	for _, id := range []string{
+		"",
+		"..",
+		"../secret",
+		"../../secret",
+		outside,
+		"/etc",
+		`..\secret`,
+		"abc/../../../secret",
+	} {
+		if filePath, err := uploadPath(id); err == nil {
+			t.Errorf("uploadPath(%q) = %s, want error", id, filePath)
+		}
+	}
+}
+
+func TestSubmitRejectsUnmanagedPaths(t *testing.T) {
+	setupDataDir(t)
+
+	for _, body := range []string{
+		`{"mode":"local","filePath":"/etc/passwd"}`,
+		`{"mode":"local","uploadId":"../../etc"}`,
+		`{"mode":"local","uploadId":"/etc"}`,
+	} {
+		rec := httptest.NewRecorder()
+		handleJobs(rec, httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body)))
+
+		var resp RepackageResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code == http.StatusAccepted || resp.Success {
+			t.Errorf("submit %s was accepted", body)
+		}
+	}
+	if len(jobs.list()) != 0 {
+		t.Errorf("rejected requests were queued: %d jobs", len(jobs.list()))
+	}
+}
+
+func TestArtifactOutsideDataDir(t *testing.T) {
+	dataDir := setupDataDir(t)
+
+	outside := filepath.Join(filepath.Dir(dataDir), "secret.difypkg")
+	os.WriteFile(outside, []byte("secret"), 0644)
+
+	// 模拟被改动的历史记录，离线包指向数据目录之外
+	for i, path := range []string{
+		outside,
+		filepath.Join(jobs.dir, "..", "..", "secret.difypkg"),
+		"../../secret.difypkg",
+	} {
+		id := "job" + string(rune('a'+i))
+		jobs.jobs[id] = &Job{
+			ID:    id,
+			State: jobSucceeded,
+			Result: &RepackageResponse{
+				Success:   true,
+				Artifacts: []Artifact{{ID: id + "-1", JobID: id, Name: "secret.difypkg", Path: path}},
+			},
+		}
+		jobs.order = append(jobs.order, id)
+
+		rec := httptest.NewRecorder()
+		handleArtifacts(rec, httptest.NewRequest("GET", "/api/artifacts/"+id+"-1", nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("download %s: status %d, want %d", path, rec.Code, http.StatusForbidden)
+		}
+
+		rec = httptest.NewRecorder()
+		handleArtifacts(rec, httptest.NewRequest("DELETE", "/api/artifacts/"+id+"-1", nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("delete %s: status %d, want %d", path, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the data directory was removed: %v", err)
+	}
+}
+
+func TestContainedPath(t *testing.T) {
+	base := t.TempDir()
+
+	for _, target := range []string{
+		"..",
+		"../x",
+		"a/../../x",
+		"/etc/passwd",
+		base,
+		base + "-other/x",
+		filepath.Join(base, "..", "x"),
+	} {
+		if path, err := containedPath(base, target); err == nil {
+			t.Errorf("containedPath(%q) = %s, want error", target, path)
+		}
+	}
+
+	for _, target := range []string{"a", "a/b", "a/../b", filepath.Join(base, "a")} {
+		if _, err := containedPath(base, target); err != nil {
+			t.Errorf("containedPath(%q): %v", target, err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 解压difypkg文件到目标目录
+func unzipPackage(pkgPath, destDir string) error {
+	reader, err := zip.OpenReader(pkgPath)
+	if err != nil {
+		return fmt.Errorf("failed to open package %s: %v", pkgPath, err)
+	}
+	defer reader.Close()
+
+	absDest, err := filepath.Abs(destDir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range reader.File {
+		// 防止压缩包内的路径逃逸出目标目录（zip slip）
+		target := filepath.Join(absDest, filepath.FromSlash(file.Name))
+		if target != absDest && !strings.HasPrefix(target, absDest+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal file path in package: %s", file.Name)
+		}
+
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := extractZipFile(file, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 解压单个文件
+func extractZipFile(file *zip.File, target string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	mode := file.Mode().Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// 将插件目录打包为difypkg，遵循.difyignore（或.gitignore）中的忽略规则
+func zipPackage(srcDir, outPath string) error {
+	matcher, err := loadIgnoreMatcher(srcDir)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+
+	writer := zip.NewWriter(out)
+
+	walkErr := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		// 版本控制目录永远不打包
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		if matcher.match(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		return addFileToZip(writer, path, rel, info)
+	})
+
+	if walkErr != nil {
+		writer.Close()
+		out.Close()
+		os.Remove(outPath)
+		return walkErr
+	}
+
+	if err := writer.Close(); err != nil {
+		out.Close()
+		os.Remove(outPath)
+		return err
+	}
+	return out.Close()
+}
+
+// 向压缩包写入单个文件
+func addFileToZip(writer *zip.Writer, path, name string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	dst, err := writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// 计算文件的sha256
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// 复制文件并设置权限
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+// 按顺序写入zip文件，名称以/结尾的为目录
+func writeTestZip(t *testing.T, path string, entries []string, content map[string]string) {
+	t.Helper()
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	writer := zip.NewWriter(out)
+	for _, name := range entries {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content[name]))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 列出目录中的全部文件及其内容，路径使用/分隔
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		content, err := os.ReadFile(path)
+		files[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestUnzipPackage(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+	}{
+		{name: "plain files", entries: []string{"manifest.yaml", "main.py"}},
+		{name: "nested directories", entries: []string{"tools/", "tools/search.py", "provider/a/b/c.yaml"}},
+		{name: "dot segments inside package", entries: []string{"tools/../main.py"}},
+		{name: "parent directory", entries: []string{"../evil.py"}, wantErr: true},
+		{name: "nested parent directory", entries: []string{"tools/../../evil.py"}, wantErr: true},
+		{name: "sibling directory with same prefix", entries: []string{"../plugin-evil/evil.py"}, wantErr: true},
+		{name: "valid files before escape", entries: []string{"main.py", "../../evil.py"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			content := map[string]string{}
+			for _, name := range tt.entries {
+				content[name] = "content of " + name
+			}
+			pkgPath := filepath.Join(dir, "plugin.difypkg")
+			writeTestZip(t, pkgPath, tt.entries, content)
+
+			destDir := filepath.Join(dir, "work", "plugin")
+			err := unzipPackage(pkgPath, destDir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// 任何情况下都不能在目标目录之外创建文件
+			for _, outside := range []string{filepath.Join(dir, "evil.py"), filepath.Join(dir, "work", "evil.py"), filepath.Join(dir, "work", "plugin-evil")} {
+				if _, err := os.Stat(outside); err == nil {
+					t.Errorf("%s was created outside of the destination", outside)
+				}
+			}
+			if tt.wantErr {
+				return
+			}
+
+			files := readTree(t, destDir)
+			for _, name := range tt.entries {
+				if name[len(name)-1] == '/' {
+					continue
+				}
+				rel := filepath.ToSlash(filepath.Clean(name))
+				if files[rel] != content[name] {
+					t.Errorf("%s = %q, want %q", rel, files[rel], content[name])
+				}
+			}
+		})
+	}
+}
+
+func TestUnzipPackageInvalidArchive(t *testing.T) {
+	pkgPath := filepath.Join(t.TempDir(), "broken.difypkg")
+	os.WriteFile(pkgPath, []byte("not a zip file"), 0644)
+	if err := unzipPackage(pkgPath, t.TempDir()); err == nil {
+		t.Error("invalid archive was accepted")
+	}
+}
+
+func TestZipPackageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		ignore map[string]string // 忽略文件名 -> 内容
+		files  map[string]string
+		want   []string // 重新打包后包含的文件
+	}{
+		{
+			name:  "no ignore file",
+			files: map[string]string{"manifest.yaml": "name: agent", "main.py": "print()", "tools/search.py": "search"},
+			want:  []string{"main.py", "manifest.yaml", "tools/search.py"},
+		},
+		{
+			name:   "difyignore with negation and directories",
+			ignore: map[string]string{".difyignore": "*.log\n!keep.log\n__pycache__/\n/build\n"},
+			files: map[string]string{
+				"main.py":                      "print()",
+				"debug.log":                    "debug",
+				"keep.log":                     "keep",
+				"tools/__pycache__/search.pyc": "bytecode",
+				"build/output.txt":             "build",
+				"tools/build/data.txt":         "nested build",
+			},
+			want: []string{".difyignore", "keep.log", "main.py", "tools/build/data.txt"},
+		},
+		{
+			name:   "difyignore takes precedence over gitignore",
+			ignore: map[string]string{".difyignore": "*.tmp\n", ".gitignore": "*.log\n"},
+			files:  map[string]string{"main.py": "print()", "cache.tmp": "tmp", "debug.log": "debug"},
+			want:   []string{".difyignore", ".gitignore", "debug.log", "main.py"},
+		},
+		{
+			name:   "wheels kept when not ignored",
+			ignore: map[string]string{".gitignore": ".venv/\n"},
+			files: map[string]string{
+				"requirements.txt":                        "requests",
+				"wheels/requests-2.32.3-py3-none-any.whl": "wheel",
+				".venv/bin/python":                        "python",
+			},
+			want: []string{".gitignore", "requirements.txt", "wheels/requests-2.32.3-py3-none-any.whl"},
+		},
+		{
+			name:  "git directory never packaged",
+			files: map[string]string{"main.py": "print()", ".git/HEAD": "ref: refs/heads/main"},
+			want:  []string{"main.py"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// 原始插件包 -> 解压
+			var entries []string
+			content := map[string]string{}
+			for name, value := range tt.files {
+				entries = append(entries, name)
+				content[name] = value
+			}
+			for name, value := range tt.ignore {
+				entries = append(entries, name)
+				content[name] = value
+			}
+			sort.Strings(entries)
+			pkgPath := filepath.Join(dir, "plugin.difypkg")
+			writeTestZip(t, pkgPath, entries, content)
+
+			pluginDir := filepath.Join(dir, "plugin")
+			if err := unzipPackage(pkgPath, pluginDir); err != nil {
+				t.Fatal(err)
+			}
+
+			// 重新打包 -> 再次解压
+			outPath := filepath.Join(dir, "plugin-offline.difypkg")
+			if err := zipPackage(pluginDir, outPath); err != nil {
+				t.Fatal(err)
+			}
+			reader, err := zip.OpenReader(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, file := range reader.File {
+				names = append(names, file.Name)
+			}
+			reader.Close()
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("packaged files = %v, want %v", names, tt.want)
+			}
+
+			extracted := filepath.Join(dir, "extracted")
+			if err := unzipPackage(outPath, extracted); err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range readTree(t, extracted) {
+				if content[name] != value {
+					t.Errorf("%s = %q after round trip, want %q", name, value, content[name])
+				}
+			}
+		})
+	}
+}
+
+func TestZipPackagePreservesExecutableMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not preserved on Windows")
+	}
+	dir := t.TempDir()
+	pluginDir := filepath.Join(dir, "plugin")
+	os.MkdirAll(pluginDir, 0755)
+	os.WriteFile(filepath.Join(pluginDir, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+
+	outPath := filepath.Join(dir, "plugin.difypkg")
+	if err := zipPackage(pluginDir, outPath); err != nil {
+		t.Fatal(err)
+	}
+	extracted := filepath.Join(dir, "extracted")
+	if err := unzipPackage(outPath, extracted); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(extracted, "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("mode = %v, want executable", info.Mode())
+	}
+}
+
+func TestZipPackageRemovesPartialOutput(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "plugin.difypkg")
+	if err := zipPackage(filepath.Join(dir, "missing"), outPath); err == nil {
+		t.Fatal("missing plugin directory was accepted")
+	}
+	if _, err := os.Stat(outPath); err == nil {
+		t.Error("partial package left behind")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// batchManifest 批量打包清单，支持YAML和JSON格式
+type batchManifest struct {
+	Workers int          `yaml:"workers" json:"workers"`
+	Plugins []batchEntry `yaml:"plugins" json:"plugins"`
+}
+
+// batchEntry 清单中的单个插件，type决定使用哪些字段
+type batchEntry struct {
+	Type string `yaml:"type" json:"type"` // "local", "market", "github"
+
+	Path string `yaml:"path" json:"path"` // local
+
+	Author  string `yaml:"author" json:"author"`   // market
+	Name    string `yaml:"name" json:"name"`       // market
+	Version string `yaml:"version" json:"version"` // market
+
+	Repo    string `yaml:"repo" json:"repo"`       // github
+	Release string `yaml:"release" json:"release"` // github
+	Asset   string `yaml:"asset" json:"asset"`     // github
+}
+
+// 单个插件的处理结果
+type batchResult struct {
+	Entry   batchEntry
+	Outputs []string
+	Err     error
+}
+
+// 处理批量打包命令
+func handleBatchCommand(cmd *cobra.Command, args []string) {
+	manifestPath := args[0]
+
+	manifest, err := loadBatchManifest(manifestPath)
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 命令行参数优先于清单中的配置
+	workers := manifest.Workers
+	if cmd.Flags().Changed("workers") || workers <= 0 {
+		workers, _ = cmd.Flags().GetInt("workers")
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	logf("Repackaging %d plugins with %d workers ...\n", len(manifest.Plugins), workers)
+	results := runBatch(manifest.Plugins, workers)
+
+	if printBatchSummary(results) > 0 {
+		os.Exit(exitCode())
+	}
+}
+
+// 读取并校验批量打包清单，本地路径相对于清单文件所在目录
+func loadBatchManifest(manifestPath string) (*batchManifest, error) {
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+
+	manifest := &batchManifest{}
+	if strings.EqualFold(filepath.Ext(manifestPath), ".json") {
+		// 同时支持顶层为数组的写法
+		if err := json.Unmarshal(content, manifest); err != nil {
+			if jsonErr := json.Unmarshal(content, &manifest.Plugins); jsonErr != nil {
+				return nil, fmt.Errorf("failed to parse manifest: %v", err)
+			}
+		}
+	} else {
+		if err := yaml.Unmarshal(content, manifest); err != nil {
+			if yamlErr := yaml.Unmarshal(content, &manifest.Plugins); yamlErr != nil {
+				return nil, fmt.Errorf("failed to parse manifest: %v", err)
+			}
+		}
+	}
+
+	if len(manifest.Plugins) == 0 {
+		return nil, fmt.Errorf("manifest %s contains no plugins", manifestPath)
+	}
+
+	baseDir := filepath.Dir(manifestPath)
+	for i, entry := range manifest.Plugins {
+		if err := entry.validate(); err != nil {
+			return nil, fmt.Errorf("plugin #%d: %v", i+1, err)
+		}
+		if entry.Type == "local" && !filepath.IsAbs(entry.Path) {
+			manifest.Plugins[i].Path = filepath.Join(baseDir, entry.Path)
+		}
+	}
+
+	return manifest, nil
+}
+
+// 校验插件条目的必填字段
+func (e batchEntry) validate() error {
+	switch e.Type {
+	case "local":
+		if e.Path == "" {
+			return fmt.Errorf("local plugin requires path")
+		}
+	case "market":
+		if e.Author == "" || e.Name == "" || e.Version == "" {
+			return fmt.Errorf("market plugin requires author, name and version")
+		}
+	case "github":
+		if e.Repo == "" || e.Release == "" || e.Asset == "" {
+			return fmt.Errorf("github plugin requires repo, release and asset")
+		}
+	default:
+		return fmt.Errorf("unsupported plugin type: %q", e.Type)
+	}
+	return nil
+}
+
+// 插件条目的可读描述
+func (e batchEntry) String() string {
+	switch e.Type {
+	case "local":
+		return "local " + e.Path
+	case "market":
+		return fmt.Sprintf("market %s/%s@%s", e.Author, e.Name, e.Version)
+	case "github":
+		return fmt.Sprintf("github %s@%s/%s", e.Repo, e.Release, e.Asset)
+	}
+	return e.Type
+}
+
+// 转换为executeRepackaging使用的命令和参数
+func (e batchEntry) commandArgs() (string, []string, error) {
+	switch e.Type {
+	case "local":
+		absPath, err := validateLocalPackage(e.Path)
+		if err != nil {
+			return "", nil, err
+		}
+		return "local", []string{absPath}, nil
+	case "market":
+		return "market", []string{e.Author, e.Name, e.Version}, nil
+	case "github":
+		return "github", []string{e.Repo, e.Release, e.Asset}, nil
+	}
+	return "", nil, fmt.Errorf("unsupported plugin type: %q", e.Type)
+}
+
+// 使用固定数量的worker并发处理插件，结果顺序与清单一致
+func runBatch(entries []batchEntry, workers int) []batchResult {
+	results := make([]batchResult, len(entries))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runBatchEntry(entries[i])
+			}
+		}()
+	}
+
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// 处理单个插件
+func runBatchEntry(entry batchEntry) batchResult {
+	logf("==> Repackaging %s\n", entry)
+
+	events := eventEmitter{plugin: entry.String()}
+	command, args, err := entry.commandArgs()
+	if err == nil && interrupted() {
+		err = errInterrupted
+	}
+	if err != nil {
+		events.result(nil, err)
+		return batchResult{Entry: entry, Err: err}
+	}
+
+	outputs, err := executeRepackaging(events, command, args...)
+	if err != nil && interrupted() {
+		err = errInterrupted
+	}
+	events.result(outputs, err)
+	return batchResult{Entry: entry, Outputs: outputs, Err: err}
+}
+
+// 打印汇总信息，返回失败的数量
+func printBatchSummary(results []batchResult) int {
+	failed := 0
+
+	logln()
+	logln("Batch summary:")
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			logf("  [FAIL] %s: %v\n", result.Entry, result.Err)
+		} else {
+			logf("  [OK]   %s -> %s\n", result.Entry, strings.Join(result.Outputs, ", "))
+		}
+	}
+	logf("%d succeeded, %d failed\n", len(results)-failed, failed)
+
+	return failed
+}
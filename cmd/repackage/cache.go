@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// 通过环境变量指定缓存目录
+const envCacheDir = "REPACKAGE_CACHE_DIR"
+
+// 在插件容器中执行时，容器内使用的缓存目录（随容器保留，不会被每次任务清理）
+const containerCacheDir = "/tmp/repackage-cache"
+
+var (
+	cacheDirFlag string // 由--cache-dir参数设置
+	noCache      bool   // 由--no-cache参数设置
+
+	// 合并命令行参数、环境变量和配置文件后的缓存目录，为空表示不使用缓存
+	cacheDir string
+)
+
+// 缓存目录中by-hash下的子目录名
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// wheelCache 按sha256和文件名保存下载过的依赖：<dir>/by-hash/<sha256>/<文件名>
+type wheelCache struct {
+	dir string
+}
+
+// cacheEntry 缓存中的单个文件
+type cacheEntry struct {
+	Name     string    `json:"name"`
+	SHA256   string    `json:"sha256"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"lastUsed"`
+	Path     string    `json:"path"`
+}
+
+// 默认缓存目录
+func defaultCacheDir() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, "dify-repackage", "wheels")
+}
+
+// 按照 命令行参数 > 环境变量 > 配置文件 > 默认值 的优先级确定缓存目录
+func resolveCacheDir(cfg *config) string {
+	if noCache {
+		return ""
+	}
+
+	dir := defaultCacheDir()
+	if cacheDirFlag != "" {
+		dir = cacheDirFlag
+	} else if value := os.Getenv(envCacheDir); value != "" {
+		dir = value
+	} else if cfg.Cache.Dir != "" {
+		dir = cfg.Cache.Dir
+	}
+
+	// 使用绝对路径，以便挂载到临时容器
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return dir
+}
+
+// 打开缓存目录，不存在时创建
+func openWheelCache(dir string) (*wheelCache, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "by-hash"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create wheel cache: %v", err)
+	}
+	return &wheelCache{dir: dir}, nil
+}
+
+// 列出缓存中的全部文件，按最近使用时间从新到旧排序
+func (c *wheelCache) entries() ([]cacheEntry, error) {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "by-hash", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []cacheEntry
+	for _, path := range paths {
+		// 跳过其他任务正在写入的临时文件，以及不是由store创建的目录
+		if strings.HasSuffix(path, ".tmp") || !sha256Pattern.MatchString(filepath.Base(filepath.Dir(path))) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		entries = append(entries, cacheEntry{
+			Name:     info.Name(),
+			SHA256:   filepath.Base(filepath.Dir(path)),
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+			Path:     path,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// 创建一个平铺的目录供pip --find-links使用，同名文件保留最近使用的版本；返回目录和清理函数
+func (c *wheelCache) linkView() (string, func(), error) {
+	entries, err := c.entries()
+	if err != nil {
+		return "", nil, err
+	}
+
+	viewDir, err := os.MkdirTemp("", "dify-repackage-cache-view-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(viewDir) }
+
+	for _, entry := range entries {
+		target := filepath.Join(viewDir, entry.Name)
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		if err := os.Symlink(entry.Path, target); err != nil {
+			if err := copyFile(entry.Path, target, 0644); err != nil {
+				cleanup()
+				return "", nil, err
+			}
+		}
+	}
+
+	return viewDir, cleanup, nil
+}
+
+// 将wheels目录中的文件存入缓存，已存在的文件只更新最近使用时间
+func (c *wheelCache) store(wheelsDir string) error {
+	files, err := os.ReadDir(wheelsDir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		src := filepath.Join(wheelsDir, file.Name())
+		sum, err := fileSHA256(src)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(c.dir, "by-hash", sum, file.Name())
+		if _, err := os.Stat(target); err == nil {
+			os.Chtimes(target, now, now)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		if err := storeFile(src, target, sum); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 先写入每个任务独有的临时文件，确认sha256后再重命名，
+// 并发缓存同一个文件的任务不会互相截断，也不会让不完整的文件出现在缓存路径上
+func storeFile(src, target, sum string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	written, err := fileSHA256(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if written != sum {
+		return fmt.Errorf("sha256 mismatch while caching %s: expected %s, got %s", filepath.Base(target), sum, written)
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// 删除超过指定时间未使用的文件，olderThan为0时清空缓存；返回删除的文件数和大小
+func (c *wheelCache) prune(olderThan time.Duration) (int, int64, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	removed := 0
+	var freed int64
+	for _, entry := range entries {
+		if olderThan > 0 && entry.LastUsed.After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Dir(entry.Path)); err != nil {
+			return removed, freed, err
+		}
+		removed++
+		freed += entry.Size
+	}
+
+	return removed, freed, nil
+}
+
+// 格式化文件大小
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// 打开命令使用的缓存
+func openCacheForCommand() *wheelCache {
+	if cacheDir == "" {
+		logln("Error: wheel cache is disabled (--no-cache)")
+		os.Exit(1)
+	}
+	cache, err := openWheelCache(cacheDir)
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return cache
+}
+
+// 处理cache ls命令
+func handleCacheLsCommand(cmd *cobra.Command, args []string) {
+	cache := openCacheForCommand()
+	entries, err := cache.entries()
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput() {
+		if entries == nil {
+			entries = []cacheEntry{}
+		}
+		json.NewEncoder(os.Stdout).Encode(entries)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tSHA256\tLAST USED")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Name, formatSize(entry.Size), entry.SHA256[:12], entry.LastUsed.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+}
+
+// 处理cache size命令
+func handleCacheSizeCommand(cmd *cobra.Command, args []string) {
+	cache := openCacheForCommand()
+	entries, err := cache.entries()
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	if jsonOutput() {
+		json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"dir":   cache.dir,
+			"files": len(entries),
+			"size":  total,
+		})
+		return
+	}
+
+	fmt.Printf("%s: %d files, %s\n", cache.dir, len(entries), formatSize(total))
+}
+
+// 处理cache prune命令
+func handleCachePruneCommand(cmd *cobra.Command, args []string) {
+	cache := openCacheForCommand()
+
+	olderThan, _ := cmd.Flags().GetDuration("older-than")
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		olderThan = 0
+	}
+
+	removed, freed, err := cache.prune(olderThan)
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput() {
+		json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"removed": removed,
+			"freed":   freed,
+		})
+		return
+	}
+
+	logf("Removed %d files, freed %s\n", removed, formatSize(freed))
+}
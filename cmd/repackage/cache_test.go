@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWheelCacheConcurrentStore(t *testing.T) {
+	cache, err := openWheelCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 多个任务同时缓存同一个依赖
+	content := bytes.Repeat([]byte("dify_plugin wheel content\n"), 64*1024)
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wheelsDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(wheelsDir, "dify_plugin-0.4.0-py3-none-any.whl"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- cache.store(wheelsDir)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("store: %v", err)
+		}
+	}
+
+	entries, err := cache.entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d cache entries, want 1: %+v", len(entries), entries)
+	}
+	cached, err := os.ReadFile(entries[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cached, content) {
+		t.Errorf("cached file has %d bytes, want %d", len(cached), len(content))
+	}
+
+	// 不应残留临时文件
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(entries[0].Path), "*.tmp"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left in cache: %v", leftovers)
+	}
+}
+
+func TestWheelCacheEntriesSkipTemporaryFiles(t *testing.T) {
+	cache, err := openWheelCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(cache.dir, "by-hash", strings.Repeat("ab", 32))
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "pkg-1.0-py3-none-any.whl.123.tmp"), []byte("partial"), 0644)
+
+	entries, err := cache.entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("temporary file listed as cache entry: %+v", entries)
+	}
+}
+
+func TestWheelCacheEntriesSkipUnknownDirectories(t *testing.T) {
+	cache, err := openWheelCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不是sha256的目录名，例如手动创建或其他程序留下的目录
+	for _, name := range []string{"abc", strings.Repeat("AB", 32), strings.Repeat("ab", 33)} {
+		dir := filepath.Join(cache.dir, "by-hash", name)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "pkg-1.0-py3-none-any.whl"), []byte("wheel"), 0644)
+	}
+	valid := filepath.Join(cache.dir, "by-hash", strings.Repeat("0f", 32))
+	os.MkdirAll(valid, 0755)
+	os.WriteFile(filepath.Join(valid, "pkg-1.0-py3-none-any.whl"), []byte("wheel"), 0644)
+
+	entries, err := cache.entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].SHA256 != strings.Repeat("0f", 32) {
+		t.Errorf("entries = %+v, want only the sha256 directory", entries)
+	}
+
+	// prune不删除未知目录
+	if removed, _, err := cache.prune(0); err != nil || removed != 1 {
+		t.Errorf("prune = %d, %v, want 1", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(cache.dir, "by-hash", "abc")); err != nil {
+		t.Errorf("unknown directory removed: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 未指定--config时在当前目录查找的配置文件
+const defaultConfigFile = "repackage.yaml"
+
+// 通过环境变量传递pip凭据，避免出现在命令行参数和日志中
+const (
+	envPipUsername = "REPACKAGE_PIP_USERNAME"
+	envPipPassword = "REPACKAGE_PIP_PASSWORD"
+)
+
+// config 配置文件内容
+type config struct {
+	Pip   pipConfig   `yaml:"pip"`
+	Cache cacheConfig `yaml:"cache"`
+}
+
+// cacheConfig 依赖缓存相关配置
+type cacheConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// pipConfig pip索引相关配置
+type pipConfig struct {
+	IndexURL       string   `yaml:"index-url"`
+	ExtraIndexURLs []string `yaml:"extra-index-urls"`
+	TrustedHosts   []string `yaml:"trusted-hosts"`
+	Username       string   `yaml:"username"`
+	Password       string   `yaml:"password"`
+}
+
+var (
+	configPath string    // 由--config参数设置
+	pipFlags   pipConfig // 由--index-url等参数设置
+
+	// 合并命令行参数、环境变量和配置文件后的pip配置
+	pipSettings pipConfig
+)
+
+// 读取配置文件，未指定--config且默认文件不存在时返回空配置
+func loadConfig() (*config, error) {
+	path := configPath
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return &config{}, nil
+		}
+		path = defaultConfigFile
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	cfg := &config{}
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// 按照 命令行参数 > 环境变量 > 配置文件 > 默认值 的优先级合并pip配置
+func resolvePipConfig(cfg *config) (pipConfig, error) {
+	resolved := cfg.Pip
+
+	if value := os.Getenv("PIP_MIRROR_URL"); value != "" {
+		resolved.IndexURL = value
+	}
+	if value := os.Getenv(envPipUsername); value != "" {
+		resolved.Username = value
+	}
+	if value := os.Getenv(envPipPassword); value != "" {
+		resolved.Password = value
+	}
+
+	if pipFlags.IndexURL != "" {
+		resolved.IndexURL = pipFlags.IndexURL
+	}
+	if len(pipFlags.ExtraIndexURLs) > 0 {
+		resolved.ExtraIndexURLs = pipFlags.ExtraIndexURLs
+	}
+	if len(pipFlags.TrustedHosts) > 0 {
+		resolved.TrustedHosts = pipFlags.TrustedHosts
+	}
+	if pipFlags.Username != "" {
+		resolved.Username = pipFlags.Username
+	}
+	if pipFlags.Password != "" {
+		resolved.Password = pipFlags.Password
+	}
+
+	if resolved.IndexURL == "" {
+		resolved.IndexURL = defaultPipMirrorURL
+	}
+
+	indexURL, err := url.Parse(resolved.IndexURL)
+	if err != nil || indexURL.Host == "" {
+		return pipConfig{}, fmt.Errorf("invalid pip index URL: %s", resolved.IndexURL)
+	}
+	for _, extra := range resolved.ExtraIndexURLs {
+		if u, err := url.Parse(extra); err != nil || u.Host == "" {
+			return pipConfig{}, fmt.Errorf("invalid pip extra index URL: %s", extra)
+		}
+	}
+
+	// 未配置信任主机时只信任主索引所在的主机
+	if len(resolved.TrustedHosts) == 0 {
+		resolved.TrustedHosts = []string{indexURL.Hostname()}
+	}
+
+	return resolved, nil
+}
+
+// 传给pip的环境变量，凭据写入主索引地址
+func (c pipConfig) env() []string {
+	indexURL := c.IndexURL
+	if c.Username != "" {
+		if u, err := url.Parse(indexURL); err == nil && u.User == nil {
+			if c.Password != "" {
+				u.User = url.UserPassword(c.Username, c.Password)
+			} else {
+				u.User = url.User(c.Username)
+			}
+			indexURL = u.String()
+		}
+	}
+
+	env := []string{"PIP_INDEX_URL=" + indexURL}
+	if len(c.ExtraIndexURLs) > 0 {
+		env = append(env, "PIP_EXTRA_INDEX_URL="+strings.Join(c.ExtraIndexURLs, " "))
+	}
+	if len(c.TrustedHosts) > 0 {
+		env = append(env, "PIP_TRUSTED_HOST="+strings.Join(c.TrustedHosts, " "))
+	}
+	return env
+}
+
+// 传给容器内repackage的命令行参数，不包含凭据
+func (c pipConfig) args() []string {
+	args := []string{"--index-url", c.IndexURL}
+	for _, extra := range c.ExtraIndexURLs {
+		args = append(args, "--extra-index-url", extra)
+	}
+	for _, host := range c.TrustedHosts {
+		args = append(args, "--trusted-host", host)
+	}
+	return args
+}
+
+// 传给容器内repackage的凭据环境变量
+func (c pipConfig) credentialEnv() []string {
+	var env []string
+	if c.Username != "" {
+		env = append(env, envPipUsername+"="+c.Username)
+	}
+	if c.Password != "" {
+		env = append(env, envPipPassword+"="+c.Password)
+	}
+	return env
+}
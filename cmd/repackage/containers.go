@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Docker Compose为容器添加的项目名标签
+	composeProjectLabel = "com.docker.compose.project"
+
+	// --auto-start和--exec ephemeral创建的临时容器的标签，便于识别残留的容器
+	temporaryContainerLabel = "dify-repackage.temporary"
+)
+
+var (
+	containerFlag   string   // 由--container参数设置，容器名或ID
+	containerLabels []string // 由--container-label参数设置，key=value或key
+	composeProject  string   // 由--compose-project参数设置
+	autoStart       bool     // 由--auto-start参数设置
+)
+
+// autoStartedContainer 由--auto-start启动的容器，批量处理时多个任务共享，最后一个任务结束后才恢复原来的状态
+type autoStartedContainer struct {
+	refs    int
+	restore func()
+}
+
+var (
+	// 查找和启动容器的过程需要串行执行，避免并发任务重复启动同一个容器
+	autoStartMu sync.Mutex
+	autoStarted = map[string]*autoStartedContainer{}
+)
+
+// containerInfo containers命令输出的一个候选容器
+type containerInfo struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	State   string `json:"state"`
+	Status  string `json:"status"`
+	Arch    string `json:"arch,omitempty"`
+	Project string `json:"project,omitempty"`
+}
+
+// 是否通过参数显式指定了容器
+func hasContainerSelection() bool {
+	return containerFlag != "" || len(containerLabels) > 0 || composeProject != ""
+}
+
+// 解析--container-label参数，只有key时表示标签存在即可
+func parseLabelSelectors(values []string) (map[string]*string, error) {
+	selectors := map[string]*string{}
+	for _, value := range values {
+		key, val, hasValue := strings.Cut(value, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid container label %q, expected key=value or key", value)
+		}
+		if hasValue {
+			selectors[key] = &val
+		} else {
+			selectors[key] = nil
+		}
+	}
+	return selectors, nil
+}
+
+// 判断容器是否满足全部标签条件
+func matchesLabels(container dockerContainer, selectors map[string]*string) bool {
+	for key, want := range selectors {
+		got, ok := container.Labels[key]
+		if !ok || (want != nil && got != *want) {
+			return false
+		}
+	}
+	return true
+}
+
+// 判断容器名或ID是否与--container匹配：容器名完全一致或ID前缀一致
+func matchesContainerFlag(container dockerContainer, value string) bool {
+	if container.Name() == strings.TrimPrefix(value, "/") {
+		return true
+	}
+	return len(value) >= 4 && strings.HasPrefix(container.ID, value)
+}
+
+// 按命令行参数筛选插件守护进程容器：--container直接指定容器；
+// --container-label按标签筛选；只指定--compose-project时在该项目中按名称和镜像识别插件容器
+func selectPluginDaemonContainers(containers []dockerContainer) ([]dockerContainer, error) {
+	if containerFlag != "" {
+		for _, container := range containers {
+			if matchesContainerFlag(container, containerFlag) {
+				return []dockerContainer{container}, nil
+			}
+		}
+		return nil, fmt.Errorf("container %q not found", containerFlag)
+	}
+
+	selectors, err := parseLabelSelectors(containerLabels)
+	if err != nil {
+		return nil, err
+	}
+	if composeProject != "" {
+		project := composeProject
+		selectors[composeProjectLabel] = &project
+	}
+
+	var selected []dockerContainer
+	for _, container := range containers {
+		if !matchesLabels(container, selectors) {
+			continue
+		}
+		if len(containerLabels) == 0 && !isPluginDaemonContainer(container) {
+			continue
+		}
+		selected = append(selected, container)
+	}
+	return selected, nil
+}
+
+// 用于错误信息的容器描述
+func describeContainers(containers []dockerContainer) string {
+	var items []string
+	for _, container := range containers {
+		item := fmt.Sprintf("%s (name: %s, image: %s", container.ShortID(), container.Name(), container.Image)
+		if project := container.Labels[composeProjectLabel]; project != "" {
+			item += ", project: " + project
+		}
+		items = append(items, item+")")
+	}
+	return strings.Join(items, ", ")
+}
+
+// 处理containers命令：列出候选的插件守护进程容器
+func handleContainersCommand(cmd *cobra.Command, args []string) {
+	client, err := getDockerClient()
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	containers, err := client.listContainers(true)
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	candidates, err := selectPluginDaemonContainers(containers)
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 同一镜像只查询一次架构
+	archByImage := map[string]string{}
+	infos := []containerInfo{}
+	for _, container := range candidates {
+		arch, ok := archByImage[container.ImageID]
+		if !ok {
+			if inspect, err := client.inspectImage(container.ImageID); err == nil {
+				arch = inspect.Os + "/" + normalizeArch(inspect.Architecture)
+			}
+			archByImage[container.ImageID] = arch
+		}
+
+		infos = append(infos, containerInfo{
+			ID:      container.ShortID(),
+			Name:    container.Name(),
+			Image:   container.Image,
+			State:   container.State,
+			Status:  container.Status,
+			Arch:    arch,
+			Project: container.Labels[composeProjectLabel],
+		})
+	}
+
+	if jsonOutput() {
+		json.NewEncoder(os.Stdout).Encode(infos)
+		return
+	}
+
+	if len(infos) == 0 {
+		logln("No plugin daemon containers found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER ID\tNAME\tIMAGE\tSTATUS\tARCH\tPROJECT")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", info.ID, info.Name, info.Image, info.Status, info.Arch, info.Project)
+	}
+	w.Flush()
+}
+
+// 记录由本进程启动的容器，返回引用计数的release函数，调用方需持有autoStartMu
+func registerAutoStarted(containerId string, restore func()) func() {
+	autoStarted[containerId] = &autoStartedContainer{refs: 1, restore: restore}
+	return autoStartedRelease(containerId)
+}
+
+// 如果容器是由本进程启动的，增加引用计数并返回release函数，调用方需持有autoStartMu
+func acquireAutoStarted(containerId string) (func(), bool) {
+	started, ok := autoStarted[containerId]
+	if !ok {
+		return nil, false
+	}
+	started.refs++
+	return autoStartedRelease(containerId), true
+}
+
+// 减少引用计数，没有任务使用时恢复容器原来的状态
+func autoStartedRelease(containerId string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			autoStartMu.Lock()
+			defer autoStartMu.Unlock()
+
+			started := autoStarted[containerId]
+			started.refs--
+			if started.refs == 0 {
+				delete(autoStarted, containerId)
+				started.restore()
+			}
+		})
+	}
+}
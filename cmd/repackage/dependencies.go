@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 确定依赖集合的方式
+const (
+	strategyRequirements = "requirements.txt" // 插件自带的requirements.txt
+	strategyUvLock       = "uv.lock"          // 用uv export从uv.lock导出固定版本
+	strategyPyproject    = "pyproject.toml"   // 从pyproject.toml的[project].dependencies生成
+	strategyLockFile     = "lock-file"        // --lock-file指定的锁定文件
+)
+
+// 确定插件的依赖集合并写入requirements.txt，返回使用的方式。
+// 依次使用requirements.txt、uv.lock（需要uv）和pyproject.toml，没有uv时uv.lock退回到pyproject.toml
+func prepareRequirements(pluginDir string) (string, error) {
+	if fileExists(filepath.Join(pluginDir, "requirements.txt")) {
+		return strategyRequirements, nil
+	}
+
+	pyprojectPath := filepath.Join(pluginDir, "pyproject.toml")
+	if fileExists(filepath.Join(pluginDir, "uv.lock")) {
+		uv, err := exec.LookPath("uv")
+		if err == nil {
+			if err := exportUvLock(uv, pluginDir); err != nil {
+				return "", err
+			}
+			return strategyUvLock, nil
+		}
+		if !fileExists(pyprojectPath) {
+			return "", fmt.Errorf("uv not found, please install uv to export the requirements from uv.lock")
+		}
+		logln("Warning: uv not found, resolving the dependencies declared in pyproject.toml without the versions pinned in uv.lock")
+	}
+
+	if fileExists(pyprojectPath) {
+		dependencies, err := readPyprojectDependencies(pyprojectPath)
+		if err != nil {
+			return "", err
+		}
+		content := strings.Join(dependencies, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(pluginDir, "requirements.txt"), []byte(content), 0644); err != nil {
+			return "", err
+		}
+		return strategyPyproject, nil
+	}
+
+	return "", errRequirementsNotFound
+}
+
+// 用uv export将uv.lock中的运行时依赖导出为requirements.txt，不包含开发依赖和插件项目本身。
+// 不导出--hash行，版本已由uv.lock固定
+func exportUvLock(uv, pluginDir string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(interruptContext, uv, "export",
+		"--frozen",
+		"--no-dev",
+		"--no-emit-project",
+		"--no-hashes",
+		"--format", "requirements-txt",
+		"--output-file", "requirements.txt",
+	)
+	cmd.Dir = pluginDir
+	cmd.Stdout = logWriter()
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("uv export: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// 读取pyproject.toml中[project]表的dependencies数组
+func readPyprojectDependencies(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		table        string
+		inArray      bool
+		found        bool
+		dependencies []string
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(stripTomlComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if !inArray {
+			if strings.HasPrefix(line, "[") {
+				table = strings.Trim(line, "[] ")
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if table != "project" || !ok || strings.TrimSpace(key) != "dependencies" {
+				continue
+			}
+			line = strings.TrimSpace(value)
+			if !strings.HasPrefix(line, "[") {
+				return nil, fmt.Errorf("invalid dependencies in %s: expected an array", filepath.Base(path))
+			}
+			line = line[1:]
+			inArray, found = true, true
+		}
+
+		values, closed := tomlArrayStrings(line)
+		dependencies = append(dependencies, values...)
+		if closed {
+			inArray = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no [project] dependencies found in %s", filepath.Base(path))
+	}
+	return dependencies, nil
+}
+
+// 去掉TOML行尾注释，忽略字符串中的#
+func stripTomlComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// 提取数组一行中以单引号或双引号括起的字符串，遇到引号外的]时数组结束。
+// 字符串中的]（例如uvicorn[standard]）不会结束数组
+func tomlArrayStrings(line string) ([]string, bool) {
+	var values []string
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ']':
+			return values, true
+		case '"', '\'':
+			end := strings.IndexByte(line[i+1:], line[i])
+			if end < 0 {
+				return values, false
+			}
+			values = append(values, line[i+1:i+1+end])
+			i += end + 1
+		}
+	}
+	return values, false
+}
+
+// 判断文件是否存在
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadPyprojectDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		pyproject string
+		want      []string
+	}{
+		{
+			name: "inline array",
+			pyproject: `[project]
+name = "plugin"
+dependencies = ["dify_plugin>=0.4.0", 'requests==2.32.3']
+`,
+			want: []string{"dify_plugin>=0.4.0", "requests==2.32.3"},
+		},
+		{
+			name: "inline array with extras",
+			pyproject: `[project]
+dependencies = ["uvicorn[standard]>=0.30", "httpx"]
+`,
+			want: []string{"uvicorn[standard]>=0.30", "httpx"},
+		},
+		{
+			name: "multi-line array with extras and markers",
+			pyproject: `[project]
+name = "plugin"
+dependencies = [
+    "dify_plugin>=0.4.0",  # SDK
+    "uvicorn[standard]>=0.30",
+    "tomli>=2.0; python_version < '3.11'",
+    'pywin32; sys_platform == "win32"',
+]
+
+[project.optional-dependencies]
+dev = ["pytest"]
+`,
+			want: []string{
+				"dify_plugin>=0.4.0",
+				"uvicorn[standard]>=0.30",
+				"tomli>=2.0; python_version < '3.11'",
+				`pywin32; sys_platform == "win32"`,
+			},
+		},
+		{
+			name: "closing bracket after last value",
+			pyproject: `[project]
+dependencies = [
+    "fastapi[all]",
+    "pydantic[email]>=2"]
+requires-python = ">=3.12"
+`,
+			want: []string{"fastapi[all]", "pydantic[email]>=2"},
+		},
+		{
+			name: "dependencies in other tables",
+			pyproject: `[tool.poetry]
+dependencies = ["ignored"]
+
+[project]
+dependencies = []
+`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pyproject.toml")
+			if err := os.WriteFile(path, []byte(tt.pyproject), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readPyprojectDependencies(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPyprojectDependenciesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		pyproject string
+	}{
+		{name: "missing", pyproject: "[project]\nname = \"plugin\"\n"},
+		{name: "not an array", pyproject: "[project]\ndependencies = \"dify_plugin\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pyproject.toml")
+			if err := os.WriteFile(path, []byte(tt.pyproject), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readPyprojectDependencies(path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
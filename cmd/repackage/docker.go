@@ -0,0 +1,721 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Docker Engine API版本，Docker 20.10及以上版本均支持
+const dockerAPIVersion = "v1.41"
+
+// 未设置DOCKER_HOST且未选择docker上下文时使用的Docker守护进程地址，Windows上为Docker Desktop的命名管道
+var defaultDockerHost = func() string {
+	if runtime.GOOS == "windows" {
+		return "npipe:////./pipe/docker_engine"
+	}
+	return "unix:///var/run/docker.sock"
+}()
+
+// dockerClient 通过HTTP调用Docker Engine API，不依赖docker命令行
+type dockerClient struct {
+	host       string // DOCKER_HOST形式的地址，用于错误信息
+	baseURL    string
+	httpClient *http.Client
+}
+
+// dockerContainer 容器列表中的一个容器
+type dockerContainer struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	ImageID string            `json:"ImageID"`
+	State   string            `json:"State"`
+	Status  string            `json:"Status"`
+	Labels  map[string]string `json:"Labels"`
+}
+
+// 容器名称，去掉API返回的前导斜杠
+func (c dockerContainer) Name() string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// 容器ID的短格式，与docker ps一致
+func (c dockerContainer) ShortID() string {
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+	return c.ID
+}
+
+// dockerImageInspect 镜像详情中的平台信息
+type dockerImageInspect struct {
+	ID           string `json:"Id"`
+	Os           string `json:"Os"`
+	Architecture string `json:"Architecture"`
+}
+
+// dockerImage 镜像列表中的一个镜像
+type dockerImage struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+}
+
+// dockerExecConfig 在容器中执行命令的参数
+type dockerExecConfig struct {
+	Cmd        []string
+	Env        []string
+	WorkingDir string
+}
+
+// dockerAPIError Docker API返回的错误
+type dockerAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *dockerAPIError) Error() string {
+	return fmt.Sprintf("docker API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+var (
+	dockerAPI     *dockerClient
+	dockerAPIErr  error
+	dockerAPIOnce sync.Once
+)
+
+// dockerEndpoint 守护进程地址及其TLS设置
+type dockerEndpoint struct {
+	Host          string // DOCKER_HOST形式的地址
+	TLS           bool   // 是否通过TLS连接tcp://地址
+	SkipTLSVerify bool   // 不校验守护进程的证书
+	CertDir       string // ca.pem、cert.pem和key.pem所在的目录，文件不存在时不使用
+}
+
+// 连接到当前Docker守护进程的默认客户端，地址的确定方式与docker命令行一致
+func getDockerClient() (*dockerClient, error) {
+	dockerAPIOnce.Do(func() {
+		endpoint, err := resolveDockerHost()
+		if err != nil {
+			dockerAPIErr = err
+			return
+		}
+		dockerAPI, dockerAPIErr = newDockerClient(endpoint)
+	})
+	return dockerAPI, dockerAPIErr
+}
+
+// 按照 DOCKER_HOST > DOCKER_CONTEXT > docker context use选择的上下文 > 平台默认地址 的优先级确定守护进程地址，
+// 使colima、OrbStack、rootless等通过docker上下文配置的环境无需额外设置。
+// 使用DOCKER_HOST时与docker命令行一样通过DOCKER_TLS_VERIFY、DOCKER_TLS和DOCKER_CERT_PATH启用TLS
+func resolveDockerHost() (dockerEndpoint, error) {
+	configDir := dockerConfigDir()
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		endpoint := dockerEndpoint{Host: host, CertDir: configDir}
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			endpoint.TLS = true
+		} else if os.Getenv("DOCKER_TLS") != "" {
+			endpoint.TLS, endpoint.SkipTLSVerify = true, true
+		}
+		if certPath := os.Getenv("DOCKER_CERT_PATH"); certPath != "" {
+			endpoint.CertDir = certPath
+		}
+		return endpoint, nil
+	}
+
+	name := os.Getenv("DOCKER_CONTEXT")
+	if name == "" {
+		var cfg struct {
+			CurrentContext string `json:"currentContext"`
+		}
+		if content, err := os.ReadFile(filepath.Join(configDir, "config.json")); err == nil {
+			json.Unmarshal(content, &cfg)
+		}
+		name = cfg.CurrentContext
+	}
+	if name == "" || name == "default" {
+		return dockerEndpoint{Host: defaultDockerHost}, nil
+	}
+	return dockerContextEndpoint(configDir, name)
+}
+
+// docker命令行的配置目录
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".docker"
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// 读取docker上下文中的守护进程地址，上下文保存在contexts/meta/<上下文名的sha256>/meta.json中，
+// TLS证书保存在contexts/tls/<上下文名的sha256>/docker/中，存在时使用TLS连接
+func dockerContextEndpoint(configDir, name string) (dockerEndpoint, error) {
+	sum := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(sum[:])
+	content, err := os.ReadFile(filepath.Join(configDir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		return dockerEndpoint{}, fmt.Errorf("docker context %q not found: %v", name, err)
+	}
+
+	var meta struct {
+		Endpoints map[string]struct {
+			Host          string `json:"Host"`
+			SkipTLSVerify bool   `json:"SkipTLSVerify"`
+		} `json:"Endpoints"`
+	}
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return dockerEndpoint{}, fmt.Errorf("invalid docker context %q: %v", name, err)
+	}
+	docker := meta.Endpoints["docker"]
+	if docker.Host == "" {
+		return dockerEndpoint{}, fmt.Errorf("docker context %q has no docker endpoint", name)
+	}
+
+	endpoint := dockerEndpoint{Host: docker.Host, SkipTLSVerify: docker.SkipTLSVerify}
+	tlsDir := filepath.Join(configDir, "contexts", "tls", id, "docker")
+	if info, err := os.Stat(tlsDir); err == nil && info.IsDir() {
+		endpoint.TLS, endpoint.CertDir = true, tlsDir
+	}
+	return endpoint, nil
+}
+
+// 根据证书目录创建TLS配置：有ca.pem时用其校验守护进程的证书，有cert.pem和key.pem时作为客户端证书
+func (e dockerEndpoint) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: e.SkipTLSVerify}
+	if e.CertDir == "" {
+		return config, nil
+	}
+
+	caPath := filepath.Join(e.CertDir, "ca.pem")
+	if content, err := os.ReadFile(caPath); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("invalid CA certificate %s", caPath)
+		}
+		config.RootCAs = pool
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	certPath, keyPath := filepath.Join(e.CertDir, "cert.pem"), filepath.Join(e.CertDir, "key.pem")
+	if fileExists(certPath) && fileExists(keyPath) {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate in %s: %v", e.CertDir, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// 创建连接到指定地址的客户端，支持unix://、tcp://（可使用TLS）和Windows的npipe://
+func newDockerClient(endpoint dockerEndpoint) (*dockerClient, error) {
+	host := endpoint.Host
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST %q: %v", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socketPath := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		}
+		return &dockerClient{host: host, baseURL: "http://docker", httpClient: &http.Client{Transport: transport}}, nil
+	case "tcp", "http", "https":
+		if !endpoint.TLS && u.Scheme != "https" {
+			return &dockerClient{host: host, baseURL: "http://" + u.Host, httpClient: &http.Client{}}, nil
+		}
+		config, err := endpoint.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		return &dockerClient{host: host, baseURL: "https://" + u.Host, httpClient: &http.Client{Transport: transport}}, nil
+	case "npipe":
+		// npipe:////./pipe/docker_engine 对应 \\.\pipe\docker_engine
+		pipePath := strings.ReplaceAll(u.Path, "/", `\`)
+		transport := &pipeTransport{dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return dialPipe(ctx, pipePath)
+		}}
+		return &dockerClient{host: host, baseURL: "http://docker", httpClient: &http.Client{Transport: transport}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported DOCKER_HOST %q, expected unix://, tcp:// or npipe://", host)
+}
+
+// pipeTransport 每个请求使用一个新连接，先写完请求再读取响应。
+// 标准库只能以同步方式打开Windows命名管道，同一连接上的读写会互相阻塞，
+// 因此不能使用http.Transport（其在发送请求的同时就开始读取响应）
+type pipeTransport struct {
+	dial func(ctx context.Context) (io.ReadWriteCloser, error)
+}
+
+func (t *pipeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := t.dial(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	stop := context.AfterFunc(req.Context(), func() { conn.Close() })
+	fail := func(err error) (*http.Response, error) {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+
+	// 连接不复用，由守护进程在响应结束后关闭
+	outgoing := req.Clone(req.Context())
+	outgoing.Close = true
+	if err := outgoing.Write(conn); err != nil {
+		return fail(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return fail(err)
+	}
+	resp.Body = &pipeBody{ReadCloser: resp.Body, conn: conn, stop: stop}
+	return resp, nil
+}
+
+// pipeBody 关闭响应时同时关闭连接
+type pipeBody struct {
+	io.ReadCloser
+	conn io.Closer
+	stop func() bool
+}
+
+func (b *pipeBody) Close() error {
+	b.stop()
+	b.ReadCloser.Close()
+	return b.conn.Close()
+}
+
+// 发送请求，返回状态码为2xx的响应，其他状态码转换为dockerAPIError
+func (c *dockerClient) do(ctx context.Context, method, endpoint string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	target := c.baseURL + "/" + dockerAPIVersion + endpoint
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to the Docker daemon at %s: %v", c.host, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		content, _ := io.ReadAll(resp.Body)
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		message := strings.TrimSpace(string(content))
+		if json.Unmarshal(content, &apiErr) == nil && apiErr.Message != "" {
+			message = apiErr.Message
+		}
+		return nil, &dockerAPIError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return resp, nil
+}
+
+// 发送JSON请求并解析JSON响应，out为nil时忽略响应内容
+func (c *dockerClient) doJSON(ctx context.Context, method, endpoint string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+		contentType = "application/json"
+	}
+
+	resp, err := c.do(ctx, method, endpoint, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// 检查Docker守护进程是否可用
+func (c *dockerClient) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/_ping", nil, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 列出容器，all为true时包括已停止的容器
+func (c *dockerClient) listContainers(all bool) ([]dockerContainer, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	var containers []dockerContainer
+	err := c.doJSON(context.Background(), http.MethodGet, "/containers/json", query, nil, &containers)
+	return containers, err
+}
+
+// 列出本地镜像
+func (c *dockerClient) listImages() ([]dockerImage, error) {
+	var images []dockerImage
+	err := c.doJSON(context.Background(), http.MethodGet, "/images/json", nil, nil, &images)
+	return images, err
+}
+
+// 查看镜像详情
+func (c *dockerClient) inspectImage(image string) (*dockerImageInspect, error) {
+	var inspect dockerImageInspect
+	if err := c.doJSON(context.Background(), http.MethodGet, "/images/"+image+"/json", nil, nil, &inspect); err != nil {
+		return nil, err
+	}
+	return &inspect, nil
+}
+
+// 启动容器
+func (c *dockerClient) startContainer(containerID string) error {
+	return c.doJSON(context.Background(), http.MethodPost, "/containers/"+containerID+"/start", nil, nil, nil)
+}
+
+// 停止容器，超过timeout秒后强制结束
+func (c *dockerClient) stopContainer(containerID string, timeout int) error {
+	query := url.Values{"t": {fmt.Sprint(timeout)}}
+	return c.doJSON(context.Background(), http.MethodPost, "/containers/"+containerID+"/stop", query, nil, nil)
+}
+
+// 创建容器，返回容器ID；platform不为空时使用该平台的镜像
+func (c *dockerClient) createContainer(name, platform string, config map[string]interface{}) (string, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	if platform != "" {
+		query.Set("platform", platform)
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.doJSON(context.Background(), http.MethodPost, "/containers/create", query, config, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// 强制删除容器
+func (c *dockerClient) removeContainer(containerID string) error {
+	query := url.Values{"force": {"1"}}
+	return c.doJSON(context.Background(), http.MethodDelete, "/containers/"+containerID, query, nil, nil)
+}
+
+// 拉取镜像，platform为空时使用守护进程的平台
+func (c *dockerClient) pullImage(image, platform string) error {
+	query := url.Values{"fromImage": {image}}
+	if platform != "" {
+		query.Set("platform", platform)
+	}
+	resp, err := c.do(context.Background(), http.MethodPost, "/images/create", query, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 拉取进度以JSON流返回，失败时流中的消息带有error字段
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+	}
+}
+
+// 连接到容器的标准输出和标准错误，返回多路复用流，容器退出后流结束。需要在启动容器前调用，避免丢失输出
+func (c *dockerClient) attachContainer(containerID string) (io.ReadCloser, error) {
+	query := url.Values{"stream": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	resp, err := c.do(context.Background(), http.MethodPost, "/containers/"+containerID+"/attach", query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// 在启动容器前注册等待，返回的函数阻塞到容器退出并返回退出码。
+// condition为removed时等到AutoRemove删除容器后返回，容器退出后立即被删除也能得到退出码
+func (c *dockerClient) waitContainer(containerID, condition string) (func() (int, error), error) {
+	query := url.Values{"condition": {condition}}
+	resp, err := c.do(context.Background(), http.MethodPost, "/containers/"+containerID+"/wait", query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (int, error) {
+		defer resp.Body.Close()
+		var result struct {
+			StatusCode int `json:"StatusCode"`
+			Error      *struct {
+				Message string `json:"Message"`
+			} `json:"Error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return -1, err
+		}
+		if result.Error != nil && result.Error.Message != "" {
+			return -1, errors.New(result.Error.Message)
+		}
+		return result.StatusCode, nil
+	}, nil
+}
+
+// 在容器中执行命令，输出分别写入stdout和stderr，返回命令的退出码
+func (c *dockerClient) exec(containerID string, config dockerExecConfig, stdout, stderr io.Writer) (int, error) {
+	ctx := context.Background()
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	createReq := map[string]interface{}{
+		"Cmd":          config.Cmd,
+		"Env":          config.Env,
+		"WorkingDir":   config.WorkingDir,
+		"AttachStdout": true,
+		"AttachStderr": true,
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/containers/"+containerID+"/exec", nil, createReq, &created); err != nil {
+		return -1, err
+	}
+
+	startReq, _ := json.Marshal(map[string]bool{"Detach": false, "Tty": false})
+	resp, err := c.do(ctx, http.MethodPost, "/exec/"+created.ID+"/start", nil, bytes.NewReader(startReq), "application/json")
+	if err != nil {
+		return -1, err
+	}
+	streamErr := demuxDockerStream(resp.Body, stdout, stderr)
+	resp.Body.Close()
+	if streamErr != nil {
+		return -1, fmt.Errorf("failed to read exec output: %v", streamErr)
+	}
+
+	var inspect struct {
+		Running  bool `json:"Running"`
+		ExitCode int  `json:"ExitCode"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil, nil, &inspect); err != nil {
+		return -1, err
+	}
+	return inspect.ExitCode, nil
+}
+
+// 在容器中执行命令并返回标准输出，退出码不为0时返回错误
+func (c *dockerClient) execOutput(containerID string, cmd ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := c.exec(containerID, dockerExecConfig{Cmd: cmd}, &stdout, &stderr)
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("%s exited with code %d: %s", strings.Join(cmd, " "), exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// 解析exec输出的多路复用流：每帧8字节头部，第1字节为流类型（1为stdout，2为stderr），后4字节为长度
+func demuxDockerStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		var w io.Writer
+		switch header[0] {
+		case 1:
+			w = stdout
+		case 2:
+			w = stderr
+		default:
+			w = io.Discard
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+// 将本地文件或目录以tar流的形式复制到容器中的containerPath，containerPath的上级目录必须存在
+func (c *dockerClient) copyToContainer(containerID, localPath, containerPath string) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeTarArchive(writer, localPath, path.Base(containerPath), info))
+	}()
+	defer reader.Close()
+
+	query := url.Values{"path": {path.Dir(containerPath)}}
+	resp, err := c.do(context.Background(), http.MethodPut, "/containers/"+containerID+"/archive", query, reader, "application/x-tar")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 将本地文件或目录写入tar流，条目名以name开头
+func writeTarArchive(w io.Writer, localPath, name string, info os.FileInfo) error {
+	tw := tar.NewWriter(w)
+
+	if !info.IsDir() {
+		if err := addFileToTar(tw, localPath, name, info); err != nil {
+			return err
+		}
+		return tw.Close()
+	}
+
+	err := filepath.Walk(localPath, func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, filePath)
+		if err != nil {
+			return err
+		}
+		return addFileToTar(tw, filePath, path.Join(name, filepath.ToSlash(rel)), fileInfo)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// 向tar流中添加一个文件或目录
+func addFileToTar(tw *tar.Writer, filePath, name string, info os.FileInfo) error {
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return nil
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// 从容器中复制单个文件到本地路径
+func (c *dockerClient) copyFromContainer(containerID, containerPath, localPath string) error {
+	query := url.Values{"path": {containerPath}}
+	resp, err := c.do(context.Background(), http.MethodGet, "/containers/"+containerID+"/archive", query, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	tr := tar.NewReader(resp.Body)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s not found in archive from container", containerPath)
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		out, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+}
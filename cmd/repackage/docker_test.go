@@ -0,0 +1,672 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker 模拟Docker Engine API中repackage用到的部分
+type fakeDocker struct {
+	mu            sync.Mutex
+	files         map[string][]byte   // 容器内的文件
+	execs         map[string][]string // exec ID -> 命令
+	exitCodes     map[string]int      // 命令名 -> 退出码
+	images        map[string]bool     // 本地已有的镜像
+	created       map[string]interface{}
+	output        []byte // attach返回的多路复用流
+	exitCode      int    // wait返回的退出码
+	waitCondition string
+	pulls         []string
+}
+
+func newFakeDocker() *fakeDocker {
+	return &fakeDocker{
+		files:     map[string][]byte{},
+		execs:     map[string][]string{},
+		exitCodes: map[string]int{},
+		images:    map[string]bool{},
+	}
+}
+
+// 构造多路复用流中的一帧
+func dockerFrame(stream byte, content string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(content)))
+	return append(header, content...)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	endpoint := strings.TrimPrefix(r.URL.Path, "/"+dockerAPIVersion)
+	parts := strings.Split(strings.Trim(endpoint, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case endpoint == "/_ping":
+		w.Write([]byte("OK"))
+
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "exec":
+		var req struct{ Cmd []string }
+		json.NewDecoder(r.Body).Decode(&req)
+		id := fmt.Sprintf("exec-%d", len(f.execs)+1)
+		f.execs[id] = req.Cmd
+		json.NewEncoder(w).Encode(map[string]string{"Id": id})
+
+	case len(parts) == 3 && parts[0] == "exec" && parts[2] == "start":
+		cmd := f.execs[parts[1]]
+		w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+		w.Write(dockerFrame(1, strings.Join(cmd, " ")+"\n"))
+		w.Write(dockerFrame(2, "stderr of "+cmd[0]+"\n"))
+
+	case len(parts) == 3 && parts[0] == "exec" && parts[2] == "json":
+		cmd := f.execs[parts[1]]
+		json.NewEncoder(w).Encode(map[string]interface{}{"Running": false, "ExitCode": f.exitCodes[cmd[0]]})
+
+	case len(parts) == 3 && parts[2] == "archive" && r.Method == http.MethodPut:
+		dir := query.Get("path")
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if header.Typeflag == tar.TypeReg {
+				content, _ := io.ReadAll(tr)
+				f.files[path.Join(dir, header.Name)] = content
+			}
+		}
+
+	case len(parts) == 3 && parts[2] == "archive" && r.Method == http.MethodGet:
+		filePath := query.Get("path")
+		content, ok := f.files[filePath]
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "Could not find the file "+filePath+" in container "+parts[1])
+			return
+		}
+		tw := tar.NewWriter(w)
+		tw.WriteHeader(&tar.Header{Name: path.Base(filePath), Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write(content)
+		tw.Close()
+
+	case endpoint == "/containers/create":
+		var config map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&config)
+		if !f.images[config["Image"].(string)] {
+			writeAPIError(w, http.StatusNotFound, "No such image: "+config["Image"].(string))
+			return
+		}
+		config["name"] = query.Get("name")
+		config["platform"] = query.Get("platform")
+		f.created = config
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"Id": "container-1"})
+
+	case endpoint == "/images/create":
+		image := query.Get("fromImage")
+		f.pulls = append(f.pulls, image+" "+query.Get("platform"))
+		fmt.Fprintln(w, `{"status":"Pulling from library/python"}`)
+		if strings.HasPrefix(image, "private/") {
+			fmt.Fprintln(w, `{"error":"pull access denied for private/image"}`)
+			return
+		}
+		f.images[image] = true
+		fmt.Fprintln(w, `{"status":"Downloaded newer image"}`)
+
+	case len(parts) == 3 && parts[2] == "attach":
+		w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+		w.Write(f.output)
+
+	case len(parts) == 3 && (parts[2] == "start" || parts[2] == "stop"):
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) == 3 && parts[2] == "wait":
+		f.waitCondition = query.Get("condition")
+		json.NewEncoder(w).Encode(map[string]interface{}{"StatusCode": f.exitCode})
+
+	case len(parts) == 2 && parts[0] == "containers" && r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeAPIError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+// 通过TCP连接到模拟的Docker守护进程
+func newFakeDockerClient(t *testing.T) (*fakeDocker, *dockerClient) {
+	t.Helper()
+	fake := newFakeDocker()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := newDockerClient(dockerEndpoint{Host: "tcp://" + server.Listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, client
+}
+
+func TestDemuxDockerStream(t *testing.T) {
+	tests := []struct {
+		name           string
+		stream         []byte
+		stdout, stderr string
+		wantErr        bool
+	}{
+		{name: "empty"},
+		{
+			name:   "interleaved",
+			stream: bytes.Join([][]byte{dockerFrame(1, "out 1\n"), dockerFrame(2, "err 1\n"), dockerFrame(1, "out 2\n")}, nil),
+			stdout: "out 1\nout 2\n",
+			stderr: "err 1\n",
+		},
+		{
+			name:   "stdin frame discarded",
+			stream: append(dockerFrame(0, "ignored"), dockerFrame(1, "out")...),
+			stdout: "out",
+		},
+		{
+			name:   "empty frame",
+			stream: append(dockerFrame(2, ""), dockerFrame(1, "out")...),
+			stdout: "out",
+		},
+		{
+			name:    "truncated header",
+			stream:  dockerFrame(1, "out")[:5],
+			wantErr: true,
+		},
+		{
+			name:    "truncated payload",
+			stream:  dockerFrame(1, "complete output")[:12],
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := demuxDockerStream(bytes.NewReader(tt.stream), &stdout, &stderr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Errorf("stdout = %q, stderr = %q, want %q, %q", stdout.String(), stderr.String(), tt.stdout, tt.stderr)
+			}
+		})
+	}
+}
+
+func TestDockerExecExitCode(t *testing.T) {
+	fake, client := newFakeDockerClient(t)
+	fake.exitCodes["false"] = 3
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := client.exec("abc", dockerExecConfig{Cmd: []string{"false", "arg"}}, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != 3 {
+		t.Errorf("exit code = %d, want 3", exitCode)
+	}
+	if stdout.String() != "false arg\n" || stderr.String() != "stderr of false\n" {
+		t.Errorf("stdout = %q, stderr = %q", stdout.String(), stderr.String())
+	}
+
+	if _, err := client.execOutput("abc", "false"); err == nil || !strings.Contains(err.Error(), "exited with code 3") {
+		t.Errorf("execOutput error = %v, want exit code 3", err)
+	}
+	output, err := client.execOutput("abc", "uname", "-m")
+	if err != nil || output != "uname -m\n" {
+		t.Errorf("execOutput = %q, %v", output, err)
+	}
+}
+
+func TestDockerCopyRoundTrip(t *testing.T) {
+	fake, client := newFakeDockerClient(t)
+	dir := t.TempDir()
+
+	// 单个文件
+	content := bytes.Repeat([]byte("difypkg"), 10000)
+	localFile := filepath.Join(dir, "plugin.difypkg")
+	os.WriteFile(localFile, content, 0644)
+	if err := client.copyToContainer("abc", localFile, "/tmp/repackage/job/plugin.difypkg"); err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(dir, "copied.difypkg")
+	if err := client.copyFromContainer("abc", "/tmp/repackage/job/plugin.difypkg", copied); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(copied); !bytes.Equal(got, content) {
+		t.Errorf("round trip returned %d bytes, want %d", len(got), len(content))
+	}
+
+	// 目录以containerPath为根目录复制
+	wheelhouse := filepath.Join(dir, "wheelhouse")
+	os.MkdirAll(filepath.Join(wheelhouse, "sub"), 0755)
+	os.WriteFile(filepath.Join(wheelhouse, "a.whl"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(wheelhouse, "sub", "b.whl"), []byte("b"), 0644)
+	if err := client.copyToContainer("abc", wheelhouse, "/tmp/repackage/job/wheelhouse"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"/tmp/repackage/job/wheelhouse/a.whl":     "a",
+		"/tmp/repackage/job/wheelhouse/sub/b.whl": "b",
+	} {
+		if got := string(fake.files[name]); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	err := client.copyFromContainer("abc", "/tmp/repackage/job/missing.difypkg", filepath.Join(dir, "missing"))
+	var apiErr *dockerAPIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("copy of missing file: err = %v, want 404", err)
+	}
+}
+
+func TestDockerAPIErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/missing/start"):
+			writeAPIError(w, http.StatusNotFound, "No such container: missing")
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("daemon is shutting down\n"))
+		default:
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message":"container is not running"}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := newDockerClient(dockerEndpoint{Host: "tcp://" + server.Listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		call    func() error
+		status  int
+		message string
+	}{
+		{"json message", func() error { return client.startContainer("missing") }, http.StatusNotFound, "No such container: missing"},
+		{"plain text body", func() error { _, err := client.listContainers(true); return err }, http.StatusInternalServerError, "daemon is shutting down"},
+		{"exec on stopped container", func() error { _, err := client.execOutput("abc", "uname"); return err }, http.StatusConflict, "container is not running"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr *dockerAPIError
+			if err := tt.call(); !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want dockerAPIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+				t.Errorf("got status %d message %q, want %d %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.message)
+			}
+		})
+	}
+
+	// 守护进程不可达时给出地址
+	unreachable, _ := newDockerClient(dockerEndpoint{Host: "unix://" + filepath.Join(t.TempDir(), "missing.sock")})
+	if err := unreachable.ping(); err == nil || !strings.Contains(err.Error(), "cannot connect to the Docker daemon") {
+		t.Errorf("ping error = %v", err)
+	}
+
+	if _, err := newDockerClient(dockerEndpoint{Host: "ssh://user@host"}); err == nil {
+		t.Error("ssh:// host was accepted")
+	}
+}
+
+// Windows命名管道使用的pipeTransport，通过unix socket连接测试
+func TestDockerPipeTransport(t *testing.T) {
+	fake := newFakeDocker()
+	fake.exitCodes["false"] = 1
+
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	server := &http.Server{Handler: fake}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := &dockerClient{
+		host:    "npipe:////./pipe/docker_engine",
+		baseURL: "http://docker",
+		httpClient: &http.Client{Transport: &pipeTransport{dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}}},
+	}
+
+	if err := client.ping(); err != nil {
+		t.Fatal(err)
+	}
+	// 同一守护进程也可以通过unix://连接
+	if unixClient, err := newDockerClient(dockerEndpoint{Host: "unix://" + socketPath}); err != nil || unixClient.ping() != nil {
+		t.Errorf("unix:// client failed: %v", err)
+	}
+	if _, err := client.execOutput("abc", "false"); err == nil || !strings.Contains(err.Error(), "exited with code 1") {
+		t.Errorf("execOutput error = %v", err)
+	}
+
+	localFile := filepath.Join(t.TempDir(), "repackage")
+	os.WriteFile(localFile, []byte("binary"), 0755)
+	if err := client.copyToContainer("abc", localFile, "/tmp/job/repackage"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(fake.files["/tmp/job/repackage"]); got != "binary" {
+		t.Errorf("copied content = %q", got)
+	}
+	if err := client.startContainer("missing"); err != nil {
+		t.Errorf("start: %v", err)
+	}
+}
+
+func TestResolveDockerHost(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", configDir)
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_CONTEXT", "")
+	t.Setenv("DOCKER_TLS_VERIFY", "")
+	t.Setenv("DOCKER_TLS", "")
+
+	// docker context create colima --docker host=...
+	writeContext := func(name, host string) {
+		sum := sha256.Sum256([]byte(name))
+		dir := filepath.Join(configDir, "contexts", "meta", hex.EncodeToString(sum[:]))
+		os.MkdirAll(dir, 0755)
+		meta := fmt.Sprintf(`{"Name":%q,"Metadata":{},"Endpoints":{"docker":{"Host":%q,"SkipTLSVerify":false}}}`, name, host)
+		os.WriteFile(filepath.Join(dir, "meta.json"), []byte(meta), 0644)
+	}
+	writeContext("colima", "unix:///Users/dev/.colima/default/docker.sock")
+	writeContext("rootless", "unix:///run/user/1000/docker.sock")
+
+	check := func(want string) {
+		t.Helper()
+		endpoint, err := resolveDockerHost()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if endpoint.Host != want || endpoint.TLS {
+			t.Errorf("endpoint = %+v, want %q without TLS", endpoint, want)
+		}
+	}
+
+	check(defaultDockerHost)
+
+	os.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"auths":{},"currentContext":"colima"}`), 0644)
+	check("unix:///Users/dev/.colima/default/docker.sock")
+
+	t.Setenv("DOCKER_CONTEXT", "rootless")
+	check("unix:///run/user/1000/docker.sock")
+
+	t.Setenv("DOCKER_CONTEXT", "default")
+	check(defaultDockerHost)
+
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2375")
+	check("tcp://127.0.0.1:2375")
+
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_CONTEXT", "missing")
+	if _, err := resolveDockerHost(); err == nil {
+		t.Error("missing context was accepted")
+	}
+}
+
+// 生成由caKey签名的证书，caCert为nil时生成自签名的CA证书
+func writeTestCert(t *testing.T, dir, name string, template *x509.Certificate, caCert *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caCert == nil {
+		caCert, caKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if name != "ca" {
+		os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	return cert, key
+}
+
+func TestDockerTLS(t *testing.T) {
+	// 要求客户端证书的守护进程，服务端和客户端证书由同一个CA签发
+	certDir := t.TempDir()
+	caCert, caKey := writeTestCert(t, certDir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "docker test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	serverDir := t.TempDir()
+	writeTestCert(t, serverDir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, caKey)
+	writeTestCert(t, certDir, "cert", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, caKey)
+
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(serverDir, "server.pem"), filepath.Join(serverDir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	server := httptest.NewUnstartedServer(newFakeDocker())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	defer server.Close()
+	host := "tcp://" + server.Listener.Addr().String()
+
+	configDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", configDir)
+	t.Setenv("DOCKER_CONTEXT", "")
+	t.Setenv("DOCKER_HOST", host)
+	t.Setenv("DOCKER_TLS", "")
+	t.Setenv("DOCKER_TLS_VERIFY", "1")
+	t.Setenv("DOCKER_CERT_PATH", certDir)
+
+	ping := func(t *testing.T) error {
+		t.Helper()
+		endpoint, err := resolveDockerHost()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := newDockerClient(endpoint)
+		if err != nil {
+			return err
+		}
+		return client.ping()
+	}
+
+	t.Run("DOCKER_TLS_VERIFY", func(t *testing.T) {
+		if err := ping(t); err != nil {
+			t.Errorf("ping over TLS: %v", err)
+		}
+	})
+
+	t.Run("plain tcp to TLS daemon", func(t *testing.T) {
+		t.Setenv("DOCKER_TLS_VERIFY", "")
+		if err := ping(t); err == nil {
+			t.Error("plain HTTP request to a TLS daemon succeeded")
+		}
+	})
+
+	t.Run("untrusted CA", func(t *testing.T) {
+		// 不含ca.pem时使用系统证书，无法校验测试CA签发的证书
+		otherDir := t.TempDir()
+		for _, name := range []string{"cert.pem", "key.pem"} {
+			content, _ := os.ReadFile(filepath.Join(certDir, name))
+			os.WriteFile(filepath.Join(otherDir, name), content, 0600)
+		}
+		t.Setenv("DOCKER_CERT_PATH", otherDir)
+		if err := ping(t); err == nil {
+			t.Error("server certificate from an unknown CA was accepted")
+		}
+		// DOCKER_TLS不校验守护进程证书，只提供客户端证书
+		t.Setenv("DOCKER_TLS_VERIFY", "")
+		t.Setenv("DOCKER_TLS", "1")
+		if err := ping(t); err != nil {
+			t.Errorf("ping with DOCKER_TLS: %v", err)
+		}
+	})
+
+	t.Run("context with TLS", func(t *testing.T) {
+		t.Setenv("DOCKER_HOST", "")
+		t.Setenv("DOCKER_TLS_VERIFY", "")
+		t.Setenv("DOCKER_CONTEXT", "remote")
+
+		// docker context create remote --docker host=...,ca=...,cert=...,key=...
+		sum := sha256.Sum256([]byte("remote"))
+		id := hex.EncodeToString(sum[:])
+		metaDir := filepath.Join(configDir, "contexts", "meta", id)
+		os.MkdirAll(metaDir, 0755)
+		meta := fmt.Sprintf(`{"Name":"remote","Metadata":{},"Endpoints":{"docker":{"Host":%q,"SkipTLSVerify":false}}}`, host)
+		os.WriteFile(filepath.Join(metaDir, "meta.json"), []byte(meta), 0644)
+		if err := ping(t); err == nil {
+			t.Error("context without TLS data connected to a TLS daemon")
+		}
+
+		tlsDir := filepath.Join(configDir, "contexts", "tls", id, "docker")
+		os.MkdirAll(tlsDir, 0700)
+		for _, name := range []string{"ca.pem", "cert.pem", "key.pem"} {
+			content, _ := os.ReadFile(filepath.Join(certDir, name))
+			os.WriteFile(filepath.Join(tlsDir, name), content, 0600)
+		}
+		if err := ping(t); err != nil {
+			t.Errorf("ping through TLS context: %v", err)
+		}
+	})
+
+	t.Run("invalid CA", func(t *testing.T) {
+		badDir := t.TempDir()
+		os.WriteFile(filepath.Join(badDir, "ca.pem"), []byte("not a certificate"), 0644)
+		if _, err := newDockerClient(dockerEndpoint{Host: host, TLS: true, CertDir: badDir}); err == nil {
+			t.Error("invalid ca.pem was accepted")
+		}
+	})
+}
+
+func TestEphemeralContainerLifecycle(t *testing.T) {
+	fake, client := newFakeDockerClient(t)
+	fake.output = bytes.Join([][]byte{
+		dockerFrame(1, `{"type":"stage","stage":"download"}`+"\n"),
+		dockerFrame(2, "Downloading ...\n"),
+		dockerFrame(1, `{"type":"artifact","path":"/workspace/plugin-offline.difypkg"}`+"\n"),
+	}, nil)
+
+	// 本地没有镜像时先拉取
+	config := map[string]interface{}{"Image": ephemeralImage, "User": "1000:1000"}
+	containerId, err := createEphemeralContainer(client, "dify-repackage-1", "linux/amd64", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.pulls) != 1 || fake.pulls[0] != ephemeralImage+" linux/amd64" {
+		t.Errorf("pulls = %v", fake.pulls)
+	}
+	if fake.created["platform"] != "linux/amd64" || fake.created["User"] != "1000:1000" || fake.created["name"] != "dify-repackage-1" {
+		t.Errorf("created with %v", fake.created)
+	}
+
+	stream, err := client.attachContainer(containerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	fake.exitCode = 2
+	wait, err := client.waitContainer(containerId, "removed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.startContainer(containerId); err != nil {
+		t.Fatal(err)
+	}
+
+	forwarder := &eventForwarder{}
+	var stderr bytes.Buffer
+	if err := demuxDockerStream(stream, forwarder, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if len(forwarder.artifacts) != 1 || forwarder.artifacts[0] != "/workspace/plugin-offline.difypkg" {
+		t.Errorf("artifacts = %v", forwarder.artifacts)
+	}
+	if stderr.String() != "Downloading ...\n" {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+
+	if exitCode, err := wait(); err != nil || exitCode != 2 {
+		t.Errorf("wait = %d, %v, want 2", exitCode, err)
+	}
+	if fake.waitCondition != "removed" {
+		t.Errorf("wait condition = %q, want removed", fake.waitCondition)
+	}
+	if err := client.removeContainer(containerId); err != nil {
+		t.Errorf("remove: %v", err)
+	}
+
+	// 拉取失败时返回流中的错误
+	if err := client.pullImage("private/image", "linux/amd64"); err == nil || !strings.Contains(err.Error(), "pull access denied") {
+		t.Errorf("pull error = %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// 命名管道只在Windows上可用
+func dialPipe(ctx context.Context, name string) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("named pipe %s is only supported on Windows", name)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// 管道的所有实例都在使用中
+const errorPipeBusy = syscall.Errno(231)
+
+// 连接到命名管道，守护进程的管道实例都在使用中时稍后重试
+func dialPipe(ctx context.Context, name string) (io.ReadWriteCloser, error) {
+	for {
+		pipe, err := os.OpenFile(name, os.O_RDWR, 0)
+		if err == nil {
+			return pipe, nil
+		}
+		if !errors.Is(err, errorPipeBusy) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
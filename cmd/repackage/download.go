@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultGithubAPIURL      = "https://github.com"
+	defaultMarketplaceAPIURL = "https://marketplace.dify.ai"
+)
+
+// 读取环境变量，未设置时使用默认值
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// 从Dify Marketplace下载插件，返回下载后的文件路径
+func downloadFromMarket(destDir, author, name, version string) (string, error) {
+	marketURL := strings.TrimSuffix(getEnvOrDefault("MARKETPLACE_API_URL", defaultMarketplaceAPIURL), "/")
+	downloadURL := fmt.Sprintf("%s/api/v1/plugins/%s/%s/%s/download", marketURL, author, name, version)
+	pkgPath := filepath.Join(destDir, safeFileName(fmt.Sprintf("%s-%s_%s", author, name, version))+".difypkg")
+
+	logln("From the Dify Marketplace downloading ...")
+	if err := downloadFile(downloadURL, pkgPath); err != nil {
+		return "", fmt.Errorf("%v, please check the plugin author, name and version", err)
+	}
+	return pkgPath, nil
+}
+
+// 从GitHub Release下载插件，返回下载后的文件路径
+func downloadFromGithub(destDir, repo, releaseTitle, assetsName string) (string, error) {
+	githubURL := strings.TrimSuffix(getEnvOrDefault("GITHUB_API_URL", defaultGithubAPIURL), "/")
+	if !strings.HasPrefix(repo, githubURL) {
+		repo = githubURL + "/" + repo
+	}
+	downloadURL := fmt.Sprintf("%s/releases/download/%s/%s", repo, releaseTitle, assetsName)
+	pluginName := strings.TrimSuffix(assetsName, ".difypkg")
+	pkgPath := filepath.Join(destDir, safeFileName(fmt.Sprintf("%s-%s", pluginName, releaseTitle))+".difypkg")
+
+	logln("From the Github downloading ...")
+	if err := downloadFile(downloadURL, pkgPath); err != nil {
+		return "", fmt.Errorf("%v, please check the github repo, release title and assets name", err)
+	}
+	return pkgPath, nil
+}
+
+// 下载文件到指定路径
+func downloadFile(url, destPath string) error {
+	logf("Downloading %s ...\n", url)
+
+	// 中断时取消下载
+	req, err := http.NewRequestWithContext(interruptContext, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		os.Remove(destPath)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	logln("Download success.")
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// 临时容器默认使用的镜像，与dify-plugin-daemon的Python版本保持一致
+const defaultEphemeralImage = "python:3.12-slim"
+
+// 由--image参数设置
+var ephemeralImage = defaultEphemeralImage
+
+// 容器内挂载工作目录和依赖缓存的位置
+const (
+	ephemeralWorkspace  = "/workspace"
+	ephemeralCacheDir   = "/cache"
+	ephemeralWheelhouse = "/wheelhouse"
+)
+
+// ephemeralGroup 由同一个临时容器打包的目标平台
+type ephemeralGroup struct {
+	arch    string           // 容器的Linux架构
+	targets []targetPlatform // 为空时由容器内的repackage按容器平台打包
+}
+
+// 按容器架构对目标平台分组：Linux目标在对应架构的容器中打包，darwin目标无法在容器中原生运行，
+// 在宿主机架构的容器中通过pip的平台参数下载。未指定目标时使用宿主机架构的容器
+func groupEphemeralTargets(targets []targetPlatform) []ephemeralGroup {
+	if len(targets) == 0 {
+		return []ephemeralGroup{{arch: runtime.GOARCH}}
+	}
+
+	var groups []ephemeralGroup
+	index := map[string]int{}
+	for _, target := range targets {
+		arch := runtime.GOARCH
+		if target.OS == "linux" {
+			arch = target.Arch
+		}
+		i, ok := index[arch]
+		if !ok {
+			i = len(groups)
+			index[arch] = i
+			groups = append(groups, ephemeralGroup{arch: arch})
+		}
+		groups[i].targets = append(groups[i].targets, target)
+	}
+	return groups
+}
+
+// 通过Docker Engine API启动一次性容器执行重新打包，每种目标架构一个容器，容器退出后自动删除
+func executeInEphemeralContainer(events eventEmitter, command string, args ...string) ([]string, error) {
+	client, err := getDockerClient()
+	if err == nil {
+		err = client.ping()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("docker is required for ephemeral execution: %v", err)
+	}
+
+	targets, err := parseTargets(targetFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputPaths []string
+	for _, group := range groupEphemeralTargets(targets) {
+		paths, err := runEphemeralContainer(client, events, group, command, args...)
+		outputPaths = append(outputPaths, paths...)
+		if err != nil {
+			return outputPaths, err
+		}
+	}
+	return outputPaths, nil
+}
+
+// 启动linux/<group.arch>平台的临时容器，工作目录通过bind mount挂载，为group中的目标平台重新打包
+func runEphemeralContainer(client *dockerClient, events eventEmitter, group ephemeralGroup, command string, args ...string) ([]string, error) {
+	platform := "linux/" + group.arch
+
+	// 查找匹配容器平台的repackage可执行文件
+	binaryPath, checked := findRepackageBinary("linux", group.arch)
+	if binaryPath == "" {
+		logln("Checked locations:")
+		for _, loc := range checked {
+			logf("  - %s\n", loc)
+		}
+		return nil, fmt.Errorf("could not find repackage-linux-%s for ephemeral container", group.arch)
+	}
+
+	workspace, err := os.MkdirTemp("", "dify-repackage-workspace-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if keepWorkspace {
+			logf("Keeping ephemeral workspace: %s\n", workspace)
+			return
+		}
+		os.RemoveAll(workspace)
+	}()
+
+	if err := copyFile(binaryPath, filepath.Join(workspace, "repackage"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to prepare workspace: %v", err)
+	}
+
+	// 构建命令参数
+	var targetArgs []string
+	for _, target := range group.targets {
+		targetArgs = append(targetArgs, target.String())
+	}
+	cmdArgs := containerRepackageArgs(ephemeralCacheDir, ephemeralWheelhouse, ephemeralWorkspace+"/requirements.lock", targetArgs, command, args...)
+
+	// 复制锁定文件到工作目录
+	if lockFileFlag != "" {
+		if err := copyFile(lockFileFlag, filepath.Join(workspace, "requirements.lock"), 0644); err != nil {
+			return nil, fmt.Errorf("failed to copy lock file to workspace: %v", err)
+		}
+	}
+
+	// 如果是本地文件模式，需要将difypkg文件复制到工作目录
+	if command == "local" {
+		safeFileName := cleanFileName(filepath.Base(args[0]))
+		if err := copyFile(args[0], filepath.Join(workspace, safeFileName), 0644); err != nil {
+			return nil, fmt.Errorf("failed to copy package to workspace: %v", err)
+		}
+		cmdArgs[len(cmdArgs)-1] = ephemeralWorkspace + "/" + safeFileName
+	}
+
+	containerName := fmt.Sprintf("dify-repackage-%d", time.Now().UnixNano())
+	events.emit(event{Type: eventEnvironment, Environment: envEphemeral})
+	events.emit(event{Type: eventContainer, Name: containerName, Image: ephemeralImage})
+
+	binds := []string{workspace + ":" + ephemeralWorkspace}
+
+	// 挂载宿主机的依赖缓存，使多次运行共享已下载的依赖
+	if cacheDir != "" {
+		if _, err := openWheelCache(cacheDir); err != nil {
+			return nil, err
+		}
+		binds = append(binds, cacheDir+":"+ephemeralCacheDir)
+	}
+	if wheelhouseDir != "" {
+		binds = append(binds, wheelhouseDir+":"+ephemeralWheelhouse+":ro")
+	}
+
+	config := ephemeralContainerConfig(append([]string{ephemeralWorkspace + "/repackage"}, cmdArgs...), binds)
+
+	if interrupted() {
+		return nil, errInterrupted
+	}
+
+	logf("Starting ephemeral container %s from %s (%s) ...\n", containerName, ephemeralImage, platform)
+	containerId, err := createEphemeralContainer(client, containerName, platform, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ephemeral container: %v", err)
+	}
+	defer func() {
+		// 已由AutoRemove删除或正在删除时忽略
+		err := client.removeContainer(containerId)
+		var apiErr *dockerAPIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusConflict) {
+			return
+		}
+		if err != nil {
+			logf("Warning: failed to remove ephemeral container %s: %v\n", containerName, err)
+		}
+	}()
+
+	// 启动前连接输出流，容器内repackage的事件经forwarder转发
+	stream, err := client.attachContainer(containerId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to ephemeral container: %v", err)
+	}
+	defer stream.Close()
+
+	wait, err := client.waitContainer(containerId, "removed")
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for ephemeral container: %v", err)
+	}
+
+	// 中断时停止容器，容器内的repackage收到SIGTERM后终止pip并退出
+	stop := context.AfterFunc(interruptContext, func() {
+		logf("Stopping ephemeral container %s ...\n", containerName)
+		if err := client.stopContainer(containerId, 10); err != nil {
+			logf("Warning: failed to stop ephemeral container %s: %v\n", containerName, err)
+		}
+	})
+	defer stop()
+
+	if err := client.startContainer(containerId); err != nil {
+		return nil, fmt.Errorf("failed to start ephemeral container: %v", err)
+	}
+
+	forwarder := &eventForwarder{events: events}
+	if err := demuxDockerStream(stream, forwarder, logWriter()); err != nil {
+		return nil, fmt.Errorf("failed to read ephemeral container output: %v", err)
+	}
+	exitCode, err := wait()
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for ephemeral container: %v", err)
+	}
+	if exitCode != 0 {
+		if forwarder.err != nil {
+			return nil, forwarder.err
+		}
+		if group.arch != runtime.GOARCH {
+			return nil, fmt.Errorf("repackage in ephemeral %s container exited with code %d, running containers of another architecture requires QEMU emulation in Docker", platform, exitCode)
+		}
+		return nil, fmt.Errorf("repackage in ephemeral container exited with code %d", exitCode)
+	}
+	if len(forwarder.artifacts) == 0 {
+		return nil, fmt.Errorf("no packaged file reported by repackage in ephemeral container")
+	}
+
+	// 容器内的离线包路径对应工作目录中的文件
+	events.stage(stageCopyBack)
+	var outputPaths []string
+	for _, artifact := range forwarder.artifacts {
+		if path.Dir(artifact) != ephemeralWorkspace {
+			return outputPaths, fmt.Errorf("unexpected packaged file outside of the ephemeral workspace: %s", artifact)
+		}
+		outputPath := filepath.Join(outputDir, path.Base(artifact))
+		if err := copyFile(filepath.Join(workspace, path.Base(artifact)), outputPath, 0644); err != nil {
+			return outputPaths, fmt.Errorf("failed to copy package from workspace: %v", err)
+		}
+		if lockEnabled() {
+			if err := copyFile(filepath.Join(workspace, path.Base(lockFilePath(artifact))), lockFilePath(outputPath), 0644); err != nil {
+				return outputPaths, fmt.Errorf("failed to copy lock file from workspace: %v", err)
+			}
+		}
+		logf("Repackaged file: %s\n", outputPath)
+		outputPaths = append(outputPaths, outputPath)
+	}
+	return outputPaths, nil
+}
+
+// 临时容器的创建参数
+func ephemeralContainerConfig(cmd, binds []string) map[string]interface{} {
+	config := map[string]interface{}{
+		"Image":      ephemeralImage,
+		"Cmd":        cmd,
+		"WorkingDir": ephemeralWorkspace,
+		// pip需要可写的HOME目录；环境变量通过API请求传递，不会出现在任何进程的命令行中
+		"Env":    append([]string{"HOME=/tmp"}, containerEnv()...),
+		"Labels": map[string]string{temporaryContainerLabel: "true"},
+		// repackage被强制终止、来不及删除容器时，由Docker在容器退出后删除
+		"HostConfig": map[string]interface{}{"Binds": binds, "AutoRemove": true},
+	}
+
+	// 在Linux上以当前用户身份运行，避免生成的文件属于root
+	if runtime.GOOS == "linux" {
+		config["User"] = fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	}
+	return config
+}
+
+// 创建临时容器，本地没有镜像时先拉取
+func createEphemeralContainer(client *dockerClient, name, platform string, config map[string]interface{}) (string, error) {
+	containerId, err := client.createContainer(name, platform, config)
+	var apiErr *dockerAPIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return containerId, err
+	}
+
+	logf("Pulling image %s (%s) ...\n", ephemeralImage, platform)
+	if err := client.pullImage(ephemeralImage, platform); err != nil {
+		return "", fmt.Errorf("failed to pull %s: %v", ephemeralImage, err)
+	}
+	return client.createContainer(name, platform, config)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestGroupEphemeralTargets(t *testing.T) {
+	host := runtime.GOARCH
+	other := "arm64"
+	if host == "arm64" {
+		other = "amd64"
+	}
+
+	tests := []struct {
+		name    string
+		targets []targetPlatform
+		want    []ephemeralGroup
+	}{
+		{
+			name: "no targets",
+			want: []ephemeralGroup{{arch: host}},
+		},
+		{
+			name:    "other linux arch",
+			targets: []targetPlatform{{OS: "linux", Arch: other}},
+			want:    []ephemeralGroup{{arch: other, targets: []targetPlatform{{OS: "linux", Arch: other}}}},
+		},
+		{
+			name:    "one container per linux arch",
+			targets: []targetPlatform{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}},
+			want: []ephemeralGroup{
+				{arch: "amd64", targets: []targetPlatform{{OS: "linux", Arch: "amd64"}}},
+				{arch: "arm64", targets: []targetPlatform{{OS: "linux", Arch: "arm64"}}},
+			},
+		},
+		{
+			name:    "darwin targets use the host arch container",
+			targets: []targetPlatform{{OS: "darwin", Arch: other}, {OS: "linux", Arch: host}},
+			want: []ephemeralGroup{
+				{arch: host, targets: []targetPlatform{{OS: "darwin", Arch: other}, {OS: "linux", Arch: host}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupEphemeralTargets(tt.targets); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEphemeralContainerConfig(t *testing.T) {
+	config := ephemeralContainerConfig([]string{"/workspace/repackage", "local", "/workspace/plugin.difypkg"}, []string{"/tmp/ws:/workspace"})
+
+	hostConfig := config["HostConfig"].(map[string]interface{})
+	if hostConfig["AutoRemove"] != true {
+		t.Error("ephemeral container is not created with AutoRemove")
+	}
+	if !reflect.DeepEqual(hostConfig["Binds"], []string{"/tmp/ws:/workspace"}) {
+		t.Errorf("binds = %v", hostConfig["Binds"])
+	}
+	if config["Image"] != ephemeralImage || config["WorkingDir"] != ephemeralWorkspace {
+		t.Errorf("config = %v", config)
+	}
+	if labels := config["Labels"].(map[string]string); labels[temporaryContainerLabel] != "true" {
+		t.Errorf("labels = %v", labels)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{name: "no rules", rules: "", path: "main.py", want: false},
+		{name: "comment and blank lines", rules: "# *.py\n\n", path: "main.py", want: false},
+		{name: "extension", rules: "*.pyc", path: "tools/cache.pyc", want: true},
+		{name: "extension does not match other files", rules: "*.pyc", path: "tools/cache.py", want: false},
+		{name: "basename in subdirectory", rules: ".env", path: "config/.env", want: true},
+		{name: "trailing whitespace", rules: "*.log  \r", path: "debug.log", want: true},
+		{name: "negation", rules: "*.md\n!README.md", path: "README.md", want: false},
+		{name: "negation keeps other matches", rules: "*.md\n!README.md", path: "CHANGELOG.md", want: true},
+		{name: "later rule wins", rules: "!README.md\n*.md", path: "README.md", want: true},
+		{name: "directory pattern matches directory", rules: "build/", path: "build", isDir: true, want: true},
+		{name: "directory pattern ignores files", rules: "build/", path: "build", want: false},
+		{name: "directory pattern in subdirectory", rules: "__pycache__/", path: "tools/__pycache__", isDir: true, want: true},
+		{name: "anchored pattern at root", rules: "/dist", path: "dist", isDir: true, want: true},
+		{name: "anchored pattern not in subdirectory", rules: "/dist", path: "tools/dist", isDir: true, want: false},
+		{name: "pattern with slash is anchored", rules: "docs/*.png", path: "docs/logo.png", want: true},
+		{name: "pattern with slash not nested", rules: "docs/*.png", path: "assets/docs/logo.png", want: false},
+		{name: "single star does not cross directories", rules: "docs/*.png", path: "docs/img/logo.png", want: false},
+		{name: "double star prefix", rules: "**/fixtures", path: "tests/unit/fixtures", isDir: true, want: true},
+		{name: "double star prefix at root", rules: "**/fixtures", path: "fixtures", isDir: true, want: true},
+		{name: "double star suffix", rules: "tests/**", path: "tests/unit/test_main.py", want: true},
+		{name: "question mark", rules: "file?.txt", path: "file1.txt", want: true},
+		{name: "question mark single character", rules: "file?.txt", path: "file10.txt", want: false},
+		{name: "character class", rules: "*.py[co]", path: "main.pyo", want: true},
+		{name: "negated character class", rules: "*.py[!c]", path: "main.pyc", want: false},
+		{name: "escaped special character", rules: `\#notes`, path: "#notes", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, ".difyignore"), []byte(tt.rules), 0644); err != nil {
+				t.Fatal(err)
+			}
+			matcher, err := loadIgnoreMatcher(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matcher.match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("match(%q, %v) with %q = %v, want %v", tt.path, tt.isDir, tt.rules, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreFilePrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  map[string]bool
+	}{
+		{
+			name:  "no ignore file",
+			files: map[string]string{},
+			want:  map[string]bool{"main.py": false, "debug.log": false},
+		},
+		{
+			name:  "gitignore only",
+			files: map[string]string{".gitignore": "*.log"},
+			want:  map[string]bool{"main.py": false, "debug.log": true},
+		},
+		{
+			name:  "difyignore takes precedence over gitignore",
+			files: map[string]string{".gitignore": "*.log", ".difyignore": "*.tmp"},
+			want:  map[string]bool{"debug.log": false, "cache.tmp": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			matcher, err := loadIgnoreMatcher(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range tt.want {
+				if got := matcher.match(path, false); got != want {
+					t.Errorf("match(%q) = %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// 被中断时的退出码，与shell中Ctrl+C终止的进程一致
+const exitInterrupted = 130
+
+var errInterrupted = errors.New("interrupted")
+
+// 收到SIGINT或SIGTERM时取消（Windows上GUI取消任务时发送的Ctrl+Break同样作为os.Interrupt收到）：本地的pip等子进程被终止，容器内的repackage收到终止信号，
+// 各执行环境在返回时清理自己的工作目录
+var interruptContext = context.Background()
+
+// 监听中断信号，第一次中断时取消interruptContext并等待清理完成，再次中断时立即退出
+func handleInterrupts() {
+	ctx, cancel := context.WithCancel(context.Background())
+	interruptContext = ctx
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		logln("Interrupted, stopping and cleaning up (press Ctrl+C again to exit immediately) ...")
+		cancel()
+
+		<-signals
+		logln("Interrupted again, exiting without cleanup")
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// 是否已被中断
+func interrupted() bool {
+	return interruptContext.Err() != nil
+}
+
+// 报告结果后的退出码：被中断时为130，其他错误为1
+func exitCode() int {
+	if interrupted() {
+		return exitInterrupted
+	}
+	return 1
+}
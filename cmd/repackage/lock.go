@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 锁定文件保存在离线包旁边，如plugin-linux-amd64-offline.difypkg.lock
+const lockFileSuffix = ".lock"
+
+var (
+	lockRequirements bool   // 由--lock参数设置
+	lockFileFlag     string // 由--lock-file参数设置，使用已有的锁定文件重新打包
+)
+
+// lockedRequirement 锁定文件中的一条依赖，同一版本可能有多个文件（如wheel和sdist）
+type lockedRequirement struct {
+	Name    string
+	Version string
+	Hashes  []string
+}
+
+// 是否需要生成锁定的依赖列表
+func lockEnabled() bool {
+	return lockRequirements || lockFileFlag != ""
+}
+
+// 离线包对应的锁定文件路径
+func lockFilePath(outputPath string) string {
+	return outputPath + lockFileSuffix
+}
+
+// 根据wheels目录中实际下载的文件生成锁定的依赖列表，按包名排序
+func lockWheels(wheelsDir string) ([]lockedRequirement, error) {
+	dists, err := listDistributions(wheelsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]*lockedRequirement{}
+	var locked []*lockedRequirement
+	for _, dist := range dists {
+		sum, err := fileSHA256(filepath.Join(wheelsDir, dist.FileName))
+		if err != nil {
+			return nil, err
+		}
+
+		key := dist.Name + "==" + dist.Version
+		req, ok := byKey[key]
+		if !ok {
+			req = &lockedRequirement{Name: dist.Name, Version: dist.Version}
+			byKey[key] = req
+			locked = append(locked, req)
+		}
+		req.Hashes = append(req.Hashes, sum)
+	}
+
+	sort.Slice(locked, func(i, j int) bool { return locked[i].Name < locked[j].Name })
+	result := make([]lockedRequirement, 0, len(locked))
+	for _, req := range locked {
+		sort.Strings(req.Hashes)
+		result = append(result, *req)
+	}
+	return result, nil
+}
+
+// 生成pip可以使用的requirements格式，每个依赖附带--hash，安装时pip会校验文件的sha256
+func formatLockedRequirements(locked []lockedRequirement) string {
+	var b strings.Builder
+	for _, req := range locked {
+		fmt.Fprintf(&b, "%s==%s", req.Name, req.Version)
+		for _, hash := range req.Hashes {
+			fmt.Fprintf(&b, " \\\n    --hash=sha256:%s", hash)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// 用锁定的依赖列表替换插件包中的requirements.txt
+func writeLockedRequirements(pluginDir string, locked []lockedRequirement) error {
+	reqPath := filepath.Join(pluginDir, "requirements.txt")
+	return os.WriteFile(reqPath, []byte(formatLockedRequirements(locked)), 0644)
+}
+
+// 在离线包旁边保存锁定文件，记录插件、平台和离线包的sha256，便于重新打包和校验
+func writeLockFile(outputPath string, identity packageIdentity, target targetPlatform, pythonVersion string, locked []lockedRequirement) (string, error) {
+	sum, err := fileSHA256(outputPath)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# plugin: %s/%s %s\n", identity.Author, identity.Name, identity.Version)
+	fmt.Fprintf(&b, "# platform: %s\n", target)
+	if pythonVersion != "" {
+		fmt.Fprintf(&b, "# python: %s\n", pythonVersion)
+	}
+	fmt.Fprintf(&b, "# package: %s sha256:%s\n", filepath.Base(outputPath), sum)
+	b.WriteString(formatLockedRequirements(locked))
+
+	lockPath := lockFilePath(outputPath)
+	if err := os.WriteFile(lockPath, []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+	return lockPath, nil
+}
+
+// 校验--lock-file参数并转换为绝对路径，锁定文件中的sha256只对应一个平台
+func resolveLockFile(lockFile string, targets []string) (string, error) {
+	if lockFile == "" {
+		return "", nil
+	}
+	parsed, err := parseTargets(targets)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed) > 1 {
+		return "", fmt.Errorf("--lock-file pins the wheels of a single platform and cannot be used with multiple targets")
+	}
+	abs, err := filepath.Abs(lockFile)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(abs); err != nil || info.IsDir() {
+		return "", fmt.Errorf("lock file %s does not exist", lockFile)
+	}
+	return abs, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLockWheels(t *testing.T) {
+	wheelsDir := t.TempDir()
+	files := map[string]string{
+		"requests-2.32.3-py3-none-any.whl":                           "requests wheel",
+		"requests-2.32.3.tar.gz":                                     "requests sdist",
+		"Flask-3.0.0-py3-none-any.whl":                               "flask wheel",
+		"pydantic_core-2.23.4-cp312-cp312-manylinux_2_17_x86_64.whl": "pydantic wheel",
+		"README.txt": "not a distribution",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(wheelsDir, name), []byte(content), 0644)
+	}
+
+	locked, err := lockWheels(wheelsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := func(names ...string) []string {
+		var hashes []string
+		for _, name := range names {
+			sum, _ := fileSHA256(filepath.Join(wheelsDir, name))
+			hashes = append(hashes, sum)
+		}
+		return hashes
+	}
+	requestsHashes := hash("requests-2.32.3-py3-none-any.whl", "requests-2.32.3.tar.gz")
+	if requestsHashes[0] > requestsHashes[1] {
+		requestsHashes[0], requestsHashes[1] = requestsHashes[1], requestsHashes[0]
+	}
+
+	// 按规范化后的包名排序，同一版本的wheel和sdist合并为一条
+	want := []lockedRequirement{
+		{Name: "flask", Version: "3.0.0", Hashes: hash("Flask-3.0.0-py3-none-any.whl")},
+		{Name: "pydantic-core", Version: "2.23.4", Hashes: hash("pydantic_core-2.23.4-cp312-cp312-manylinux_2_17_x86_64.whl")},
+		{Name: "requests", Version: "2.32.3", Hashes: requestsHashes},
+	}
+	if !reflect.DeepEqual(locked, want) {
+		t.Errorf("got %+v, want %+v", locked, want)
+	}
+}
+
+func TestLockedRequirementsRoundTrip(t *testing.T) {
+	a, b, c := strings.Repeat("a", 64), strings.Repeat("b", 64), strings.Repeat("c", 64)
+	locked := []lockedRequirement{
+		{Name: "flask", Version: "3.0.0", Hashes: []string{a}},
+		{Name: "requests", Version: "2.32.3", Hashes: []string{b, c}},
+	}
+
+	content := formatLockedRequirements(locked)
+	wantContent := "flask==3.0.0 \\\n    --hash=sha256:" + a + "\n" +
+		"requests==2.32.3 \\\n    --hash=sha256:" + b + " \\\n    --hash=sha256:" + c + "\n"
+	if content != wantContent {
+		t.Errorf("formatted:\n%s\nwant:\n%s", content, wantContent)
+	}
+
+	// 写入的requirements.txt可以被readRequirements读回
+	pluginDir := t.TempDir()
+	if err := writeLockedRequirements(pluginDir, locked); err != nil {
+		t.Fatal(err)
+	}
+	requirements, err := readRequirements(filepath.Join(pluginDir, "requirements.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []requirement{
+		{Line: "flask==3.0.0", Name: "flask", Specifier: "==3.0.0", Hashes: []string{a}},
+		{Line: "requests==2.32.3", Name: "requests", Specifier: "==2.32.3", Hashes: []string{b, c}},
+	}
+	if !reflect.DeepEqual(requirements, want) {
+		t.Errorf("read back %+v, want %+v", requirements, want)
+	}
+}
+
+func TestParseRequirementHashes(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		hashes []string
+	}{
+		{line: "requests==2.32.3", name: "requests"},
+		{line: "requests==2.32.3 --hash=sha256:abc", name: "requests", hashes: []string{"abc"}},
+		{line: "requests==2.32.3 --hash=sha256:abc --hash=sha256:def", name: "requests", hashes: []string{"abc", "def"}},
+		{line: "requests==2.32.3 --hash=md5:abc --hash=sha256:def", name: "requests", hashes: []string{"def"}},
+		{line: "Requests[socks]==2.32.3 ; python_version >= '3.8' --hash=sha256:abc", name: "requests", hashes: []string{"abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			req, ok := parseRequirementLine(tt.line)
+			if !ok {
+				t.Fatal("line not parsed")
+			}
+			if req.Name != tt.name || !reflect.DeepEqual(req.Hashes, tt.hashes) {
+				t.Errorf("got name %q hashes %v, want %q %v", req.Name, req.Hashes, tt.name, tt.hashes)
+			}
+		})
+	}
+
+	// 大小写不同的sha256视为一致
+	if !hashListed([]string{"ABCDEF"}, "abcdef") {
+		t.Error("hash comparison is case sensitive")
+	}
+	if hashListed([]string{"abc"}, "abd") {
+		t.Error("different hash accepted")
+	}
+}
+
+func TestWriteLockFile(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "langgenius-agent_0.0.9-linux-amd64-offline.difypkg")
+	os.WriteFile(outputPath, []byte("package"), 0644)
+	sum, _ := fileSHA256(outputPath)
+
+	identity := marketIdentity("langgenius", "agent", "0.0.9")
+	locked := []lockedRequirement{{Name: "requests", Version: "2.32.3", Hashes: []string{strings.Repeat("b", 64)}}}
+	lockPath, err := writeLockFile(outputPath, identity, targetPlatform{OS: "linux", Arch: "amd64"}, "3.12", locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockPath != outputPath+".lock" {
+		t.Errorf("lock path = %s", lockPath)
+	}
+
+	content, _ := os.ReadFile(lockPath)
+	wantHeader := "# plugin: langgenius/agent 0.0.9\n" +
+		"# platform: linux/amd64\n" +
+		"# python: 3.12\n" +
+		"# package: " + filepath.Base(outputPath) + " sha256:" + sum + "\n"
+	if !strings.HasPrefix(string(content), wantHeader) {
+		t.Errorf("lock file:\n%s\nwant header:\n%s", content, wantHeader)
+	}
+
+	// 锁定文件可以直接作为--lock-file的requirements使用，注释行被忽略
+	requirements, err := readRequirements(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requirements) != 1 || requirements[0].Name != "requests" || len(requirements[0].Hashes) != 1 {
+		t.Errorf("requirements = %+v", requirements)
+	}
+}
+
+func TestResolveLockFile(t *testing.T) {
+	dir := t.TempDir()
+	lockFile := filepath.Join(dir, "plugin.difypkg.lock")
+	os.WriteFile(lockFile, []byte("requests==2.32.3\n"), 0644)
+
+	tests := []struct {
+		name     string
+		lockFile string
+		targets  []string
+		wantErr  bool
+	}{
+		{name: "not set"},
+		{name: "single target", lockFile: lockFile, targets: []string{"linux/amd64"}},
+		{name: "no target", lockFile: lockFile},
+		{name: "multiple targets", lockFile: lockFile, targets: []string{"linux/amd64,linux/arm64"}, wantErr: true},
+		{name: "missing file", lockFile: filepath.Join(dir, "missing.lock"), wantErr: true},
+		{name: "directory", lockFile: dir, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveLockFile(tt.lockFile, tt.targets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.lockFile != "" && !filepath.IsAbs(got) {
+				t.Errorf("path %q is not absolute", got)
+			}
+		})
+	}
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -45,15 +50,155 @@ var (
 		Args:  cobra.ExactArgs(3),
 		Run:   handleGithubCommand,
 	}
+
+	batchCmd = &cobra.Command{
+		Use:   "batch [manifest file]",
+		Short: "Repackage multiple plugins listed in a manifest file",
+		Long:  "Repackage local, marketplace and GitHub plugins listed in a YAML or JSON manifest file",
+		Args:  cobra.ExactArgs(1),
+		Run:   handleBatchCommand,
+	}
+
+	verifyCmd = &cobra.Command{
+		Use:   "verify [offline difypkg file]",
+		Short: "Check that an offline package can be installed without network access",
+		Long:  "Check the requirements header, the bundled wheels for the package platform and the ignore rules of an offline package",
+		Args:  cobra.ExactArgs(1),
+		Run:   handleVerifyCommand,
+	}
+
+	inspectCmd = &cobra.Command{
+		Use:   "inspect [difypkg file]",
+		Short: "Show the plugin metadata from manifest.yaml",
+		Long:  "Show the author, name, version, type, runner and Python version declared in the manifest.yaml of a plugin package",
+		Args:  cobra.ExactArgs(1),
+		Run:   handleInspectCommand,
+	}
+
+	containersCmd = &cobra.Command{
+		Use:   "containers",
+		Short: "List candidate plugin daemon containers",
+		Long:  "List plugin daemon containers with their image, status and architecture, filtered by --container, --container-label and --compose-project",
+		Args:  cobra.NoArgs,
+		Run:   handleContainersCommand,
+	}
+
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the wheel cache",
+		Long:  "Manage the persistent cache of downloaded wheels shared by all repackaging runs",
+	}
+
+	cacheLsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List cached wheels",
+		Args:  cobra.NoArgs,
+		Run:   handleCacheLsCommand,
+	}
+
+	cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached wheels that have not been used recently",
+		Args:  cobra.NoArgs,
+		Run:   handleCachePruneCommand,
+	}
+
+	cacheSizeCmd = &cobra.Command{
+		Use:   "size",
+		Short: "Show the total size of the wheel cache",
+		Args:  cobra.NoArgs,
+		Run:   handleCacheSizeCommand,
+	}
 )
 
 func init() {
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text or json")
+	rootCmd.PersistentFlags().StringVar(&execMode, "exec", execModeAuto, "Execution environment: auto, local, container, in-docker or ephemeral")
+	rootCmd.PersistentFlags().StringSliceVar(&targetFlags, "target", nil, "Target platforms such as linux/amd64,linux/arm64 (default: platform of the execution environment)")
+	rootCmd.PersistentFlags().StringVar(&pythonVersionFlag, "python-version", "", "Python version of the plugin runtime used to select wheels (default: version declared in manifest.yaml)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file (default: ./repackage.yaml if present)")
+	rootCmd.PersistentFlags().StringVar(&pipFlags.IndexURL, "index-url", "", "pip index URL (default: $PIP_MIRROR_URL or "+defaultPipMirrorURL+")")
+	rootCmd.PersistentFlags().StringArrayVar(&pipFlags.ExtraIndexURLs, "extra-index-url", nil, "Extra pip index URL, can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&pipFlags.TrustedHosts, "trusted-host", nil, "pip trusted host, can be repeated (default: host of the index URL)")
+	rootCmd.PersistentFlags().StringVar(&pipFlags.Username, "pip-username", "", "Username for the pip index (or $"+envPipUsername+")")
+	rootCmd.PersistentFlags().StringVar(&pipFlags.Password, "pip-password", "", "Password for the pip index (prefer $"+envPipPassword+")")
+	rootCmd.PersistentFlags().StringVar(&cacheDirFlag, "cache-dir", "", "Wheel cache directory (default: $"+envCacheDir+" or the user cache directory)")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Do not read or write the wheel cache")
+	rootCmd.PersistentFlags().StringVar(&wheelhouseDir, "wheelhouse", "", "Resolve requirements only from this directory of wheels, without network access")
+	rootCmd.PersistentFlags().StringVar(&containerFlag, "container", "", "Name or ID of the plugin daemon container to use")
+	rootCmd.PersistentFlags().StringArrayVar(&containerLabels, "container-label", nil, "Select the plugin daemon container by label key=value, can be repeated")
+	rootCmd.PersistentFlags().StringVar(&composeProject, "compose-project", "", "Select the plugin daemon container of this Docker Compose project")
+	rootCmd.PersistentFlags().BoolVar(&autoStart, "auto-start", false, "Start a stopped plugin daemon container, or a temporary one from its image, and restore the original state afterwards")
+	rootCmd.PersistentFlags().StringVar(&outputDirFlag, "output-dir", "", "Directory for repackaged files (default: current directory)")
+	rootCmd.PersistentFlags().StringVar(&nameTemplate, "name-template", "", "File name template for repackaged files, fields: {author}, {name}, {version}, {platform}, {source}")
+	rootCmd.PersistentFlags().BoolVar(&lockRequirements, "lock", false, "Pin every downloaded wheel with its sha256 in requirements.txt and save a .lock file next to the output")
+	rootCmd.PersistentFlags().StringVar(&lockFileFlag, "lock-file", "", "Rebuild from a previously saved .lock file, verifying the sha256 of every wheel (implies --lock)")
+	rootCmd.PersistentFlags().BoolVar(&keepWorkspace, "keep-workspace", false, "Keep the job workspace inside the container after the run")
+	rootCmd.PersistentFlags().StringVar(&ephemeralImage, "image", defaultEphemeralImage, "Python image used by --exec=ephemeral, started once for each linux architecture in --target")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "Answer yes to all prompts")
+	rootCmd.PersistentFlags().BoolVar(&nonInteractive, "non-interactive", false, "Fail instead of prompting for input")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if outputFormat != outputText && outputFormat != outputJSON {
+			return fmt.Errorf("unsupported output format: %s", outputFormat)
+		}
+		if _, err := parseTargets(targetFlags); err != nil {
+			return err
+		}
+		if pythonVersionFlag != "" {
+			version, ok := normalizePythonVersion(pythonVersionFlag)
+			if !ok {
+				return fmt.Errorf("invalid Python version %q, expected a version such as 3.12", pythonVersionFlag)
+			}
+			pythonVersionFlag = version
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if pipSettings, err = resolvePipConfig(cfg); err != nil {
+			return err
+		}
+		cacheDir = resolveCacheDir(cfg)
+		if wheelhouseDir, err = resolveWheelhouse(wheelhouseDir); err != nil {
+			return err
+		}
+		if err := validateNameTemplate(nameTemplate, targetFlags); err != nil {
+			return err
+		}
+		if outputDir, err = resolveOutputDir(outputDirFlag); err != nil {
+			return err
+		}
+		if lockFileFlag, err = resolveLockFile(lockFileFlag, targetFlags); err != nil {
+			return err
+		}
+		if _, err := parseLabelSelectors(containerLabels); err != nil {
+			return err
+		}
+
+		return validateExecMode(execMode)
+	}
+
 	rootCmd.AddCommand(localCmd)
 	rootCmd.AddCommand(marketCmd)
 	rootCmd.AddCommand(githubCmd)
+	rootCmd.AddCommand(batchCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(containersCmd)
+	rootCmd.AddCommand(cacheCmd)
+
+	cacheCmd.AddCommand(cacheLsCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheSizeCmd)
+
+	batchCmd.Flags().IntP("workers", "w", 1, "Number of plugins to repackage concurrently")
+	cachePruneCmd.Flags().Duration("older-than", 30*24*time.Hour, "Remove wheels not used within this duration")
+	cachePruneCmd.Flags().Bool("all", false, "Remove all cached wheels")
 }
 
 func main() {
+	handleInterrupts()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -62,29 +207,34 @@ func main() {
 
 // 处理本地打包命令
 func handleLocalCommand(cmd *cobra.Command, args []string) {
-	packagePath := args[0]
+	absPath, err := validateLocalPackage(args[0])
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
+	// 检查环境并执行重新打包
+	runRepackaging("local", absPath)
+}
+
+// 验证本地difypkg文件，返回其绝对路径
+func validateLocalPackage(packagePath string) (string, error) {
 	// 验证文件扩展名
 	if !strings.HasSuffix(packagePath, ".difypkg") {
-		fmt.Println("Error: File must have .difypkg extension")
-		os.Exit(1)
+		return "", fmt.Errorf("file must have .difypkg extension")
 	}
 
 	// 验证文件存在
 	if _, err := os.Stat(packagePath); os.IsNotExist(err) {
-		fmt.Printf("Error: File %s does not exist\n", packagePath)
-		os.Exit(1)
+		return "", fmt.Errorf("file %s does not exist", packagePath)
 	}
 
 	// 获取文件的绝对路径
 	absPath, err := filepath.Abs(packagePath)
 	if err != nil {
-		fmt.Printf("Error: Failed to get absolute path: %v\n", err)
-		os.Exit(1)
+		return "", fmt.Errorf("failed to get absolute path: %v", err)
 	}
-
-	// 检查环境并执行重新打包
-	executeRepackaging("local", absPath)
+	return absPath, nil
 }
 
 // 处理市场下载命令
@@ -94,7 +244,7 @@ func handleMarketCommand(cmd *cobra.Command, args []string) {
 	version := args[2]
 
 	// 检查环境并执行重新打包
-	executeRepackaging("market", author, name, version)
+	runRepackaging("market", author, name, version)
 }
 
 // 处理GitHub下载命令
@@ -104,7 +254,53 @@ func handleGithubCommand(cmd *cobra.Command, args []string) {
 	assetsName := args[2]
 
 	// 检查环境并执行重新打包
-	executeRepackaging("github", repo, releaseTitle, assetsName)
+	runRepackaging("github", repo, releaseTitle, assetsName)
+}
+
+// 执行重新打包并报告结果，失败时退出进程
+func runRepackaging(command string, args ...string) {
+	events := eventEmitter{}
+	outputPaths, err := executeRepackaging(events, command, args...)
+	if err != nil && interrupted() {
+		err = errInterrupted
+	}
+	events.result(outputPaths, err)
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(exitCode())
+	}
+}
+
+// 执行环境选择
+const (
+	execModeAuto      = "auto"
+	execModeLocal     = "local"
+	execModeContainer = "container"
+	execModeInDocker  = "in-docker"
+	execModeEphemeral = "ephemeral"
+)
+
+var (
+	execMode       = execModeAuto // 由--exec参数设置
+	assumeYes      bool           // 由--yes参数设置
+	nonInteractive bool           // 由--non-interactive参数设置
+)
+
+// 校验--exec参数
+func validateExecMode(mode string) error {
+	switch mode {
+	case execModeAuto, execModeLocal, execModeContainer, execModeInDocker, execModeEphemeral:
+		return nil
+	}
+	return fmt.Errorf("unsupported execution environment: %s (expected auto, local, container, in-docker or ephemeral)", mode)
+}
+
+// 确定实际使用的执行环境，FORCE_LOCAL_EXECUTION等同于--exec=local
+func resolveExecMode() string {
+	if execMode == execModeAuto && isForceLocal() {
+		return execModeLocal
+	}
+	return execMode
 }
 
 // 检查是否强制本地执行
@@ -132,572 +328,613 @@ func isInDocker() bool {
 	return false
 }
 
-// 检查是否已安装Docker
-func isDockerInstalled() bool {
-	cmd := exec.Command("docker", "--version")
-	if err := cmd.Run(); err != nil {
+// 检查Docker守护进程是否可以通过Engine API访问
+func isDockerAvailable() bool {
+	client, err := getDockerClient()
+	if err != nil {
 		return false
 	}
-	return true
+	return client.ping() == nil
 }
 
 // 检查是否有dify-plugin-daemon镜像
 func hasDifyPluginDaemonImage() bool {
-	// 检查镜像
-	cmd := exec.Command("docker", "images", "--format", "{{.Repository}}")
-	output, err := cmd.Output()
+	client, err := getDockerClient()
 	if err != nil {
 		return false
 	}
 
-	// 检查是否有dify-plugin-daemon镜像
-	if strings.Contains(string(output), "dify-plugin-daemon") {
-		return true
+	// 检查镜像
+	images, err := client.listImages()
+	if err != nil {
+		return false
+	}
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if strings.Contains(tag, "dify-plugin-daemon") {
+				return true
+			}
+		}
 	}
 
 	// 检查容器
-	cmd = exec.Command("docker", "ps", "-a", "--format", "{{.Image}}")
-	output, err = cmd.Output()
+	containers, err := client.listContainers(true)
 	if err != nil {
 		return false
 	}
+	for _, container := range containers {
+		if strings.Contains(container.Image, "dify-plugin-daemon") {
+			return true
+		}
+	}
+	return false
+}
 
-	return strings.Contains(string(output), "dify-plugin-daemon")
+// 将文件或目录复制到Docker容器
+func copyToDockerContainer(containerId, localPath, containerPath string) error {
+	client, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+	return client.copyToContainer(containerId, localPath, containerPath)
 }
 
-// 将文件复制到Docker容器
-func copyToDockerContainer(containerId, localFilePath, containerPath string) error {
-	cmd := exec.Command("docker", "cp", localFilePath, fmt.Sprintf("%s:%s", containerId, containerPath))
-	return cmd.Run()
+// 传递到容器内repackage的环境变量
+var containerPassthroughEnv = []string{"MARKETPLACE_API_URL", "GITHUB_API_URL"}
+
+// 传递到容器内的环境变量（KEY=VALUE），包括pip凭据
+func containerEnv() []string {
+	var env []string
+	for _, key := range containerPassthroughEnv {
+		if value := os.Getenv(key); value != "" {
+			env = append(env, key+"="+value)
+		}
+	}
+	return append(env, pipSettings.credentialEnv()...)
 }
 
 // 在Docker容器中执行命令
 func execInDockerContainer(containerId string, args ...string) error {
-	cmdArgs := append([]string{"exec", containerId}, args...)
-	cmd := exec.Command("docker", cmdArgs...)
+	return execInDockerContainerAt(containerId, "", logWriter(), os.Stderr, args...)
+}
 
-	// 将容器的输出传递到当前终端
-	stdout, err := cmd.StdoutPipe()
+// 在Docker容器的指定工作目录中执行命令，输出写入stdout和stderr，退出码不为0时返回错误
+func execInDockerContainerAt(containerId, workDir string, stdout, stderr io.Writer, args ...string) error {
+	client, err := getDockerClient()
 	if err != nil {
 		return err
 	}
-	stderr, err := cmd.StderrPipe()
+
+	// 环境变量通过API请求传递，不会出现在任何进程的命令行中
+	exitCode, err := client.exec(containerId, dockerExecConfig{
+		Cmd:        args,
+		Env:        containerEnv(),
+		WorkingDir: workDir,
+	}, stdout, stderr)
 	if err != nil {
 		return err
 	}
-
-	if err := cmd.Start(); err != nil {
-		return err
+	if exitCode != 0 {
+		return fmt.Errorf("%s exited with code %d", args[0], exitCode)
 	}
+	return nil
+}
 
-	// 实时输出容器日志
-	go io.Copy(os.Stdout, stdout)
-	go io.Copy(os.Stderr, stderr)
-
-	return cmd.Wait()
+// 判断容器是否为插件守护进程容器：容器名或镜像名包含plugin_daemon或plugin-daemon关键字
+func isPluginDaemonContainer(container dockerContainer) bool {
+	name := strings.ToLower(container.Name())
+	image := strings.ToLower(container.Image)
+	return strings.Contains(name, "plugin_daemon") ||
+		strings.Contains(name, "plugin-daemon") ||
+		strings.Contains(image, "plugin-daemon") ||
+		strings.Contains(image, "plugin_daemon")
 }
 
-// 获取dify-plugin-daemon容器ID
-func getDifyPluginDaemonContainerId() (string, error) {
-	// 首先尝试查找运行中的容器，使用更宽松的匹配方式
-	cmd := exec.Command("docker", "ps", "--filter", "status=running", "--format", "{{.ID}}\t{{.Names}}\t{{.Image}}")
-	output, err := cmd.Output()
-	if err == nil && len(output) > 0 {
-		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-		for _, line := range lines {
-			if line == "" {
-				continue
-			}
-			parts := strings.Split(line, "\t")
-			if len(parts) >= 3 {
-				containerId := parts[0]
-				containerName := parts[1]
-				imageName := parts[2]
-
-				// 如果容器名或镜像名包含plugin_daemon或plugin-daemon关键字
-				if strings.Contains(strings.ToLower(containerName), "plugin_daemon") ||
-					strings.Contains(strings.ToLower(containerName), "plugin-daemon") ||
-					strings.Contains(strings.ToLower(imageName), "plugin-daemon") ||
-					strings.Contains(strings.ToLower(imageName), "dahk-plugin-daemon") ||
-					strings.Contains(strings.ToLower(imageName), "docker-plugin_daemon") ||
-					strings.Contains(strings.ToLower(imageName), "dify-plugin-daemon") {
-					fmt.Printf("Found running plugin daemon container: %s (name: %s, image: %s)\n",
-						containerId, containerName, imageName)
-					return containerId, nil
-				}
-			}
-		}
+// 获取dify-plugin-daemon容器ID，有多个运行中的候选容器时要求通过参数指定。
+// 指定--auto-start时会启动已停止的容器或从镜像创建临时容器，返回的release函数用于恢复原来的状态
+func getDifyPluginDaemonContainerId() (string, func(), error) {
+	noop := func() {}
+
+	autoStartMu.Lock()
+	defer autoStartMu.Unlock()
+
+	client, err := getDockerClient()
+	if err != nil {
+		return "", noop, err
 	}
 
-	// 如果没有找到运行中的容器，查找所有容器
-	cmd = exec.Command("docker", "ps", "-a", "--format", "{{.ID}}\t{{.Names}}\t{{.Image}}")
-	output, err = cmd.Output()
+	containers, err := client.listContainers(true)
 	if err != nil {
-		return "", err
+		return "", noop, err
 	}
 
-	// 记录找到的已停止容器
-	var stoppedContainerId, stoppedContainerName string
+	candidates, err := selectPluginDaemonContainers(containers)
+	if err != nil {
+		return "", noop, err
+	}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
+	var running, stopped []dockerContainer
+	for _, container := range candidates {
+		if container.State == "running" {
+			running = append(running, container)
+		} else {
+			stopped = append(stopped, container)
 		}
+	}
 
-		parts := strings.Split(line, "\t")
-		if len(parts) >= 3 {
-			containerId := parts[0]
-			containerName := parts[1]
-			imageName := parts[2]
-
-			if strings.Contains(strings.ToLower(containerName), "plugin_daemon") ||
-				strings.Contains(strings.ToLower(containerName), "plugin-daemon") ||
-				strings.Contains(strings.ToLower(imageName), "plugin-daemon") ||
-				strings.Contains(strings.ToLower(imageName), "dify-plugin-daemon") {
-				stoppedContainerId = containerId
-				stoppedContainerName = containerName
-				break
-			}
+	switch {
+	case len(running) == 1:
+		container := running[0]
+		logf("Found running plugin daemon container: %s (name: %s, image: %s)\n",
+			container.ShortID(), container.Name(), container.Image)
+		if release, ok := acquireAutoStarted(container.ID); ok {
+			return container.ID, release, nil
 		}
+		return container.ID, noop, nil
+	case len(running) > 1:
+		return "", noop, fmt.Errorf("found %d running plugin daemon containers: %s. Please select one using --container, --container-label or --compose-project",
+			len(running), describeContainers(running))
+	}
+
+	// 如果找到了停止的容器，启动它或建议用户启动
+	if len(stopped) > 0 {
+		container := stopped[0]
+		if !autoStart {
+			return "", noop, fmt.Errorf("found stopped plugin daemon container: %s (name: %s). Please start it using: docker start %s, or rerun with --auto-start",
+				container.ShortID(), container.Name(), container.ShortID())
+		}
+		return startStoppedContainer(client, container)
 	}
 
-	// 如果找到了停止的容器，建议启动它
-	if stoppedContainerId != "" {
-		return "", fmt.Errorf("found stopped plugin daemon container: %s (name: %s). Please start it using: docker start %s",
-			stoppedContainerId, stoppedContainerName, stoppedContainerId)
+	if hasContainerSelection() {
+		return "", noop, fmt.Errorf("no plugin daemon container matches --container, --container-label or --compose-project")
 	}
 
 	// 如果没有找到容器，检查是否有相关镜像
-	cmd = exec.Command("docker", "images", "--format", "{{.Repository}}:{{.Tag}}")
-	output, err = cmd.Output()
+	images, err := client.listImages()
 	if err == nil {
-		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-		for _, line := range lines {
-			if strings.Contains(strings.ToLower(line), "plugin-daemon") ||
-				strings.Contains(strings.ToLower(line), "dify-plugin-daemon") {
-				imageName := line
-				return "", fmt.Errorf("found plugin daemon image: %s, but no container exists. Please start a container using: docker run -d --name plugin-daemon-repackage %s",
-					imageName, imageName)
+		for _, image := range images {
+			for _, tag := range image.RepoTags {
+				if strings.Contains(strings.ToLower(tag), "plugin-daemon") {
+					if !autoStart {
+						return "", noop, fmt.Errorf("found plugin daemon image: %s, but no container exists. Please start a container using: docker run -d --name plugin-daemon-repackage %s, or rerun with --auto-start",
+							tag, tag)
+					}
+					return startTemporaryContainer(client, tag)
+				}
 			}
 		}
 	}
 
-	return "", fmt.Errorf("no plugin daemon container or image found")
-}
-
-// 执行脚本
-func executeScript(cmdName string, args ...string) error {
-	cmd := exec.Command(cmdName, args...)
-
-	// 将脚本输出传递到当前终端
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	return cmd.Run()
+	return "", noop, fmt.Errorf("no plugin daemon container or image found")
 }
 
-// 获取脚本所在目录
-func getScriptDir() string {
-	// 尝试多种方式获取脚本路径
+// 启动已停止的插件容器，release时重新停止
+func startStoppedContainer(client *dockerClient, container dockerContainer) (string, func(), error) {
+	logf("Starting stopped plugin daemon container: %s (name: %s) ...\n", container.ShortID(), container.Name())
+	if err := client.startContainer(container.ID); err != nil {
+		return "", func() {}, fmt.Errorf("failed to start container %s: %v", container.Name(), err)
+	}
 
-	// 1. 首先检查可执行文件所在目录
-	exec, err := os.Executable()
-	if err == nil {
-		dir := filepath.Dir(exec)
-		scriptPath := filepath.Join(dir, "plugin_repackaging.sh")
-		if _, err := os.Stat(scriptPath); err == nil {
-			fmt.Println("Found script in executable directory:", scriptPath)
-			return dir
+	restore := func() {
+		logf("Stopping plugin daemon container %s to restore its original state ...\n", container.Name())
+		if err := client.stopContainer(container.ID, 10); err != nil {
+			logf("Warning: failed to stop container %s: %v\n", container.Name(), err)
 		}
 	}
+	return container.ID, registerAutoStarted(container.ID, restore), nil
+}
 
-	// 2. 检查当前工作目录
-	cwd, err := os.Getwd()
-	if err == nil {
-		scriptPath := filepath.Join(cwd, "plugin_repackaging.sh")
-		if _, err := os.Stat(scriptPath); err == nil {
-			fmt.Println("Found script in current directory:", scriptPath)
-			return cwd
-		}
+// 从插件镜像创建临时容器，不运行守护进程本身，release时删除
+func startTemporaryContainer(client *dockerClient, image string) (string, func(), error) {
+	name := fmt.Sprintf("dify-repackage-daemon-%d", time.Now().UnixNano())
+	logf("Creating temporary container %s from %s ...\n", name, image)
+
+	containerId, err := client.createContainer(name, "", map[string]interface{}{
+		"Image":      image,
+		"Entrypoint": []string{"tail", "-f", "/dev/null"},
+		"Labels":     map[string]string{temporaryContainerLabel: "true"},
+	})
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to create temporary container from %s: %v", image, err)
 	}
 
-	// 3. 检查bin目录
-	if err == nil {
-		binPath := filepath.Join(filepath.Dir(cwd), "bin")
-		scriptPath := filepath.Join(binPath, "plugin_repackaging.sh")
-		if _, err := os.Stat(scriptPath); err == nil {
-			fmt.Println("Found script in bin directory:", scriptPath)
-			return binPath
+	restore := func() {
+		logf("Removing temporary container %s ...\n", name)
+		if err := client.removeContainer(containerId); err != nil {
+			logf("Warning: failed to remove temporary container %s: %v\n", name, err)
 		}
 	}
 
-	// 4. 使用当前可执行文件目录作为默认值
-	if err == nil {
-		return filepath.Dir(exec)
+	if err := client.startContainer(containerId); err != nil {
+		restore()
+		return "", func() {}, fmt.Errorf("failed to start temporary container %s: %v", name, err)
 	}
-
-	// 如果所有方法都失败，使用当前目录
-	fmt.Println("Warning: Could not determine script directory, using current directory")
-	dir, _ := os.Getwd()
-	return dir
+	return containerId, registerAutoStarted(containerId, restore), nil
 }
 
-// 执行重新打包
-func executeRepackaging(command string, args ...string) {
-	scriptDir := getScriptDir()
-	scriptPath := filepath.Join(scriptDir, "plugin_repackaging.sh")
-
-	// 检查脚本是否存在
-	if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
-		fmt.Printf("Error: Script not found at %s\n", scriptPath)
-
-		// 尝试在当前目录下查找
-		cwd, _ := os.Getwd()
-		altPath := filepath.Join(cwd, "cmd", "repackage", "plugin_repackaging.sh")
-		if _, err := os.Stat(altPath); err == nil {
-			fmt.Printf("Found script at alternative location: %s\n", altPath)
-			scriptPath = altPath
-		} else {
-			fmt.Println("Error: Could not find plugin_repackaging.sh script")
-			os.Exit(1)
-		}
+// 在当前进程内执行重新打包，输出到--output-dir指定的目录
+func executeNatively(events eventEmitter, command string, args ...string) ([]string, error) {
+	r, err := newRepackager(outputDir, events)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("Using script: %s\n", scriptPath)
-
-	// 确保脚本可执行
-	if err := os.Chmod(scriptPath, 0755); err != nil {
-		fmt.Printf("Error: Failed to set script permissions: %v\n", err)
-		os.Exit(1)
+	outputPaths, err := r.run(command, args...)
+	if err != nil {
+		return nil, err
 	}
 
-	// 获取当前操作系统和架构以确定dify-plugin文件名
-	osType := strings.ToLower(getOSType())
-	archName := strings.ToLower(getArchName())
+	for _, outputPath := range outputPaths {
+		logf("Repackaged file: %s\n", outputPath)
+	}
+	return outputPaths, nil
+}
 
-	// 确定对应的dify-plugin文件名
-	var difyPluginName string
-	if osType == "darwin" {
-		if archName == "arm64" {
-			difyPluginName = "dify-plugin-darwin-arm64-5g"
-		} else {
-			difyPluginName = "dify-plugin-darwin-amd64-5g"
-		}
-	} else if osType == "linux" {
-		if archName == "aarch64" || archName == "arm64" {
-			difyPluginName = "dify-plugin-linux-arm64-5g"
-		} else {
-			difyPluginName = "dify-plugin-linux-amd64-5g"
-		}
-	} else {
-		fmt.Printf("Warning: Unsupported OS type: %s\n", osType)
+// 将uname或Docker返回的架构名转换为Go的架构名
+func normalizeArch(arch string) string {
+	switch strings.ToLower(arch) {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
 	}
+	return strings.ToLower(arch)
+}
 
-	// 在脚本目录和bin目录中查找dify-plugin文件
-	difyPluginPath := ""
-	possibleLocations := []string{
-		filepath.Join(scriptDir, difyPluginName),
-		filepath.Join(filepath.Dir(scriptDir), "bin", difyPluginName),
-		filepath.Join("..", "bin", difyPluginName),
-		filepath.Join("bin", difyPluginName),
+// 查找可在目标平台运行的repackage可执行文件，返回找到的路径和检查过的位置
+func findRepackageBinary(osType, arch string) (string, []string) {
+	exePath, err := os.Executable()
+	if err == nil && osType == runtime.GOOS && arch == runtime.GOARCH {
+		return exePath, nil
 	}
 
+	binaryName := fmt.Sprintf("repackage-%s-%s", osType, arch)
+	var possibleLocations []string
+	if err == nil {
+		exeDir := filepath.Dir(exePath)
+		possibleLocations = append(possibleLocations,
+			// Mac应用程序包Resources目录或bin目录（与当前可执行文件同目录）
+			filepath.Join(exeDir, binaryName),
+			filepath.Join(filepath.Dir(exeDir), "bin", binaryName),
+		)
+	}
+	possibleLocations = append(possibleLocations,
+		filepath.Join("..", "bin", binaryName),
+		filepath.Join("bin", binaryName),
+	)
+
 	for _, loc := range possibleLocations {
 		if _, err := os.Stat(loc); err == nil {
-			difyPluginPath = loc
-			fmt.Printf("Found dify-plugin at: %s\n", difyPluginPath)
-			break
+			return loc, possibleLocations
 		}
 	}
+	return "", possibleLocations
+}
 
-	if difyPluginPath == "" {
-		fmt.Printf("Warning: Could not find %s file. The operation may fail.\n", difyPluginName)
-	}
+// 执行重新打包，返回生成的离线包路径（每个目标平台一个）
+func executeRepackaging(events eventEmitter, command string, args ...string) ([]string, error) {
+	switch resolveExecMode() {
+	case execModeInDocker:
+		logln("Running in Docker environment, executing directly...")
+		events.emit(event{Type: eventEnvironment, Environment: envInDocker})
+		return executeNatively(events, command, args...)
+
+	case execModeLocal:
+		logln("Executing locally...")
+		events.emit(event{Type: eventEnvironment, Environment: envLocal})
+		return executeNatively(events, command, args...)
+
+	case execModeContainer:
+		containerId, release, err := getDifyPluginDaemonContainerId()
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return runInContainer(events, containerId, command, args...)
 
-	// 构建命令参数
-	cmdArgs := append([]string{command}, args...)
+	case execModeEphemeral:
+		return executeInEphemeralContainer(events, command, args...)
+	}
 
+	// 自动检测执行环境
 	if isInDocker() {
-		fmt.Println("Running in Docker environment, executing script directly...")
+		logln("Running in Docker environment, executing directly...")
+		events.emit(event{Type: eventEnvironment, Environment: envInDocker})
+		return executeNatively(events, command, args...)
+	}
 
-		// 在Docker内直接执行脚本
-		if err := executeScript(scriptPath, cmdArgs...); err != nil {
-			fmt.Printf("Error: Failed to execute script: %v\n", err)
-			os.Exit(1)
+	// 显式指定了容器时直接使用，不依赖镜像名称判断，也不回退到本地执行
+	if hasContainerSelection() {
+		containerId, release, err := getDifyPluginDaemonContainerId()
+		if err != nil {
+			return nil, err
 		}
+		defer release()
+		return runInContainer(events, containerId, command, args...)
+	}
 
-	} else if isDockerInstalled() && hasDifyPluginDaemonImage() && !isForceLocal() {
-		fmt.Println("Docker installed with dify-plugin-daemon image, executing in container...")
+	if isDockerAvailable() && hasDifyPluginDaemonImage() {
+		logln("Docker installed with dify-plugin-daemon image, executing in container...")
 
 		// 获取容器ID
-		containerId, err := getDifyPluginDaemonContainerId()
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+		containerId, release, err := getDifyPluginDaemonContainerId()
+		if err == nil {
+			defer release()
+			return runInContainer(events, containerId, command, args...)
+		}
 
-			// 对于任何Docker相关错误，都提供本地执行的选项
-			// 首先显示可能的解决方法
-			if strings.Contains(err.Error(), "docker run") || strings.Contains(err.Error(), "docker start") {
-				fmt.Println("You can follow the instructions above to use Docker container.")
-				fmt.Println("Alternatively, you can execute the operation locally.")
-			}
+		logf("Error: %v\n", err)
 
-			// 询问用户是否想在本地执行（如果强制本地执行则自动选择yes）
-			if isForceLocal() {
-				fmt.Println("Force local execution enabled, executing locally...")
-			} else {
-				fmt.Print("Do you want to execute locally instead? (yes/no): ")
-				reader := bufio.NewReader(os.Stdin)
-				response, _ := reader.ReadString('\n')
-				response = strings.TrimSpace(response)
-
-				if strings.ToLower(response) != "yes" && strings.ToLower(response) != "y" {
-					fmt.Println("Operation cancelled. Please fix the Docker container issue and try again.")
-					os.Exit(1)
-				}
-			}
+		// 对于任何Docker相关错误，都提供本地执行的选项
+		// 首先显示可能的解决方法
+		if strings.Contains(err.Error(), "docker run") || strings.Contains(err.Error(), "docker start") {
+			logln("You can follow the instructions above to use Docker container.")
+			logln("Alternatively, you can execute the operation locally.")
+		}
 
-			// 用户选择本地执行
-			fmt.Println("Executing script locally...")
-			if err := executeScript(scriptPath, cmdArgs...); err != nil {
-				fmt.Printf("Error: Failed to execute script: %v\n", err)
-				os.Exit(1)
-			}
-			return
+		// 询问用户是否想在本地执行
+		ok, confirmErr := confirm("Do you want to execute locally instead? (yes/no): ")
+		if confirmErr != nil {
+			return nil, confirmErr
+		}
+		if !ok {
+			return nil, fmt.Errorf("operation cancelled, please fix the Docker container issue and try again")
 		}
 
-		// Docker工作目录
-		containerWorkDir := "/tmp/repackage"
+		// 用户选择本地执行
+		logln("Executing locally...")
+		events.emit(event{Type: eventEnvironment, Environment: envLocal})
+		return executeNatively(events, command, args...)
+	}
 
-		// 在容器中创建工作目录
-		if err := execInDockerContainer(containerId, "mkdir", "-p", containerWorkDir); err != nil {
-			fmt.Printf("Error: Failed to create directory in container: %v\n", err)
-			os.Exit(1)
-		}
+	// 既不在Docker内也没有Docker环境
+	logln("Not running in Docker and Docker not available.")
 
-		// 复制脚本到容器
-		if err := copyToDockerContainer(containerId, scriptPath, containerWorkDir); err != nil {
-			fmt.Printf("Error: Failed to copy script to container: %v\n", err)
-			os.Exit(1)
-		}
+	ok, err := confirm("Do you want to execute locally? (yes/no): ")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("please install Docker to continue or run this tool inside a Docker container")
+	}
 
-		// 获取容器的操作系统和架构
-		fmt.Println("Detecting container OS and architecture...")
-		osCmd := exec.Command("docker", "exec", containerId, "uname")
-		osOutput, err := osCmd.Output()
-		containerOS := strings.ToLower(strings.TrimSpace(string(osOutput)))
+	logln("Executing locally...")
+	events.emit(event{Type: eventEnvironment, Environment: envLocal})
+	return executeNatively(events, command, args...)
+}
 
-		archCmd := exec.Command("docker", "exec", containerId, "uname", "-m")
-		archOutput, err := archCmd.Output()
-		containerArch := strings.ToLower(strings.TrimSpace(string(archOutput)))
+// 在插件容器中执行并报告执行环境
+func runInContainer(events eventEmitter, containerId, command string, args ...string) ([]string, error) {
+	events.emit(event{Type: eventEnvironment, Environment: envContainer})
+	events.emit(event{Type: eventContainer, ContainerID: containerId})
+	return executeInContainer(events, containerId, command, args...)
+}
 
-		fmt.Printf("Container OS: %s, Architecture: %s\n", containerOS, containerArch)
+// 向用户提问并读取yes/no回答，--yes时直接同意，--non-interactive时返回错误而不是等待输入
+func confirm(prompt string) (bool, error) {
+	if assumeYes {
+		logf("%syes (--yes)\n", prompt)
+		return true, nil
+	}
+	if nonInteractive {
+		return false, fmt.Errorf("confirmation required in non-interactive mode: %q, use --yes or --exec to choose the execution environment", strings.TrimSpace(prompt))
+	}
 
-		// 确定容器需要的dify-plugin版本
-		containerPluginName := ""
-		if containerOS == "linux" {
-			if containerArch == "aarch64" || containerArch == "arm64" {
-				containerPluginName = "dify-plugin-linux-arm64-5g"
-			} else {
-				containerPluginName = "dify-plugin-linux-amd64-5g"
-			}
-		} else {
-			fmt.Printf("Warning: Unsupported container OS: %s. Using local plugin file.\n", containerOS)
-			containerPluginName = difyPluginName
-		}
-
-		// 查找匹配容器的插件文件，支持多种可能的位置
-		var containerPluginPath string
-		possibleContainerLocations := []string{
-			// Mac应用程序包Resources目录（与当前脚本同目录）
-			filepath.Join(scriptDir, containerPluginName),
-			// 传统的bin目录
-			filepath.Join(filepath.Dir(scriptDir), "bin", containerPluginName),
-			// 相对路径的bin目录
-			filepath.Join("..", "bin", containerPluginName),
-			filepath.Join("bin", containerPluginName),
-		}
-
-		fmt.Printf("Searching for container plugin file: %s\n", containerPluginName)
-		for _, loc := range possibleContainerLocations {
-			fmt.Printf("  Checking: %s\n", loc)
-			if _, err := os.Stat(loc); err == nil {
-				containerPluginPath = loc
-				fmt.Printf("Found container compatible dify-plugin at: %s\n", containerPluginPath)
-				break
-			}
-		}
+	fmt.Fprint(logWriter(), prompt)
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "yes" || response == "y", nil
+}
 
-		if containerPluginPath == "" {
-			fmt.Printf("Error: Could not find %s for container in any of the following locations:\n", containerPluginName)
-			for _, loc := range possibleContainerLocations {
-				fmt.Printf("  - %s\n", loc)
-			}
-			os.Exit(1)
-		}
+// 容器内各任务工作目录的上级目录
+const containerWorkRoot = "/tmp/repackage"
 
-		// 复制dify-plugin文件到容器
-		containerDestPath := filepath.Join(containerWorkDir, containerPluginName)
-		fmt.Printf("Copying dify-plugin to container: %s -> %s\n", containerPluginPath, containerDestPath)
+// 由--keep-workspace参数设置，保留容器内的任务目录便于排查问题
+var keepWorkspace bool
 
-		if err := copyToDockerContainer(containerId, containerPluginPath, containerWorkDir); err != nil {
-			fmt.Printf("Error: Failed to copy dify-plugin to container: %v\n", err)
-			os.Exit(1)
+// 生成任务目录名，保证并发任务和多个宿主机进程之间互不冲突
+func newJobID() string {
+	random := make([]byte, 4)
+	rand.Read(random)
+	return fmt.Sprintf("job-%d-%s", time.Now().UnixNano(), hex.EncodeToString(random))
+}
+
+// 将与目标容器平台匹配的repackage复制到容器中执行，并将结果复制回本地
+func executeInContainer(events eventEmitter, containerId, command string, args ...string) ([]string, error) {
+	// 每个任务使用独立的工作目录
+	jobDir := containerWorkRoot + "/" + newJobID()
+
+	// 在容器中创建工作目录
+	if err := execInDockerContainer(containerId, "mkdir", "-p", jobDir); err != nil {
+		return nil, fmt.Errorf("failed to create directory in container: %v", err)
+	}
+	defer func() {
+		if keepWorkspace {
+			logf("Keeping container workspace: %s\n", jobDir)
+			return
+		}
+		if err := execInDockerContainer(containerId, "rm", "-rf", jobDir); err != nil {
+			logf("Warning: failed to remove container workspace %s: %v\n", jobDir, err)
 		}
+	}()
+
+	// 获取容器的操作系统和架构
+	logln("Detecting container OS and architecture...")
+	client, err := getDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	osOutput, err := client.execOutput(containerId, "uname")
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect container OS: %v", err)
+	}
+	containerOS := strings.ToLower(strings.TrimSpace(osOutput))
 
-		// 设置执行权限
-		if err := execInDockerContainer(containerId, "chmod", "+x", containerDestPath); err != nil {
-			fmt.Printf("Error: Failed to set dify-plugin permissions: %v\n", err)
-			os.Exit(1)
+	archOutput, err := client.execOutput(containerId, "uname", "-m")
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect container architecture: %v", err)
+	}
+	containerArch := normalizeArch(strings.TrimSpace(archOutput))
+
+	logf("Container OS: %s, Architecture: %s\n", containerOS, containerArch)
+
+	// 查找匹配容器平台的repackage可执行文件
+	binaryPath, checked := findRepackageBinary(containerOS, containerArch)
+	if binaryPath == "" {
+		logln("Checked locations:")
+		for _, loc := range checked {
+			logf("  - %s\n", loc)
 		}
+		return nil, fmt.Errorf("could not find repackage-%s-%s for container", containerOS, containerArch)
+	}
 
-		// 如果是本地文件模式，需要复制difypkg文件到容器
-		if command == "local" {
-			packagePath := args[0]
-			originalFileName := filepath.Base(packagePath)
+	// 复制repackage到容器
+	containerBinaryPath := jobDir + "/repackage"
+	logf("Copying repackage to container: %s -> %s\n", binaryPath, containerBinaryPath)
+	if err := copyToDockerContainer(containerId, binaryPath, containerBinaryPath); err != nil {
+		return nil, fmt.Errorf("failed to copy repackage to container: %v", err)
+	}
 
-			// 清理文件名：去掉空格和特殊字符，保留字母、数字、下划线、连字符和点号
-			safeFileName := cleanFileName(originalFileName)
+	// 设置执行权限
+	if err := execInDockerContainer(containerId, "chmod", "+x", containerBinaryPath); err != nil {
+		return nil, fmt.Errorf("failed to set repackage permissions: %v", err)
+	}
 
-			fmt.Printf("Copying package file: %s -> %s\n", originalFileName, safeFileName)
+	// 构建命令参数
+	cmdArgs := containerRepackageArgs(containerCacheDir, jobDir+"/wheelhouse", jobDir+"/requirements.lock", targetFlags, command, args...)
 
-			// 复制文件到容器，使用清理后的文件名
-			if err := copyToDockerContainer(containerId, packagePath, containerWorkDir+"/"+safeFileName); err != nil {
-				fmt.Printf("Error: Failed to copy package to container: %v\n", err)
-				os.Exit(1)
-			}
+	// 复制离线依赖目录到容器
+	if wheelhouseDir != "" {
+		logf("Copying wheelhouse to container: %s\n", wheelhouseDir)
+		if err := copyToDockerContainer(containerId, wheelhouseDir, jobDir+"/wheelhouse"); err != nil {
+			return nil, fmt.Errorf("failed to copy wheelhouse to container: %v", err)
+		}
+	}
 
-			// 更新参数为容器内的清理后文件路径
-			cmdArgs[1] = filepath.Join(containerWorkDir, safeFileName)
-		}
-
-		// 在容器中执行脚本
-		containerScriptPath := filepath.Join(containerWorkDir, "plugin_repackaging.sh")
-		fmt.Printf("Executing script in container: %s %s\n", containerScriptPath, strings.Join(cmdArgs, " "))
-		execArgs := append([]string{containerScriptPath}, cmdArgs...)
-		if err := execInDockerContainer(containerId, execArgs...); err != nil {
-			fmt.Printf("Error: Failed to execute script in container: %v\n", err)
-			os.Exit(1)
-		}
-
-		// 根据命令类型选择合适的搜索模式，并从容器中复制打包后的文件
-		var findPattern string
-		switch command {
-		case "local":
-			// 对于本地文件模式，基于清理后的文件名生成查询模式
-			packagePath := args[0]
-			originalFileName := filepath.Base(packagePath)
-			cleanedFileName := cleanFileName(originalFileName)
-			baseName := strings.TrimSuffix(cleanedFileName, ".difypkg")
-			findPattern = baseName + "*-offline.difypkg"
-		case "market":
-			// 对于市场命令，使用插件名和版本号生成查询模式
-			pluginName := args[1]
-			pluginVersion := args[2]
-			findPattern = fmt.Sprintf("*%s*%s*-offline.difypkg", pluginName, pluginVersion)
-		case "github":
-			// 对于github命令，使用资源名称生成查询模式
-			assetsName := args[2]
-			baseName := strings.TrimSuffix(assetsName, ".difypkg")
-			findPattern = baseName + "*-offline.difypkg"
-		}
-
-		// 从容器中复制打包后的文件到本地
-		if findPattern != "" {
-			if err := copyPackagedFileFromContainer(containerId, containerWorkDir, findPattern); err != nil {
-				fmt.Printf("Error: %v\n", err)
-				os.Exit(1)
-			}
+	// 复制锁定文件到容器
+	if lockFileFlag != "" {
+		if err := copyToDockerContainer(containerId, lockFileFlag, jobDir+"/requirements.lock"); err != nil {
+			return nil, fmt.Errorf("failed to copy lock file to container: %v", err)
 		}
+	}
 
-	} else {
-		// 既不在Docker内也没有Docker环境
-		fmt.Println("Not running in Docker and Docker not available.")
+	// 如果是本地文件模式，需要复制difypkg文件到容器
+	if command == "local" {
+		packagePath := args[0]
+		originalFileName := filepath.Base(packagePath)
 
-		// 如果强制本地执行，自动选择yes
-		if isForceLocal() {
-			fmt.Println("Force local execution enabled, executing locally...")
-		} else {
-			fmt.Print("Do you want to execute locally? (yes/no): ")
+		// 清理文件名：去掉空格和特殊字符，保留字母、数字、下划线、连字符和点号
+		safeFileName := cleanFileName(originalFileName)
 
-			reader := bufio.NewReader(os.Stdin)
-			response, _ := reader.ReadString('\n')
-			response = strings.TrimSpace(response)
+		logf("Copying package file: %s -> %s\n", originalFileName, safeFileName)
 
-			if strings.ToLower(response) != "yes" && strings.ToLower(response) != "y" {
-				fmt.Println("Please install Docker to continue or run this tool inside a Docker container.")
-				os.Exit(1)
-			}
+		// 复制文件到容器，使用清理后的文件名
+		if err := copyToDockerContainer(containerId, packagePath, jobDir+"/"+safeFileName); err != nil {
+			return nil, fmt.Errorf("failed to copy package to container: %v", err)
 		}
 
-		fmt.Println("Executing script locally...")
-		fmt.Printf("Command: %s %s\n", scriptPath, strings.Join(cmdArgs, " "))
+		// 更新参数为容器内的清理后文件路径
+		cmdArgs[len(cmdArgs)-1] = jobDir + "/" + safeFileName
+	}
 
-		if err := executeScript(scriptPath, cmdArgs...); err != nil {
-			fmt.Printf("Error: Failed to execute script: %v\n", err)
-			os.Exit(1)
-		}
+	if interrupted() {
+		return nil, errInterrupted
 	}
-}
 
-// 获取操作系统类型
-func getOSType() string {
-	cmd := exec.Command("uname")
-	output, err := cmd.Output()
-	if err != nil {
-		return "unknown"
+	// 在容器中执行repackage，离线包路径由容器内repackage的artifact事件给出。
+	// 通过sh记录进程号，中断时向容器内的repackage发送SIGTERM，由其终止pip并清理临时目录
+	logf("Executing in container: %s %s\n", containerBinaryPath, strings.Join(cmdArgs, " "))
+	pidFile := jobDir + "/repackage.pid"
+	execArgs := append([]string{"sh", "-c", `echo $$ > "$0" && exec "$@"`, pidFile, containerBinaryPath}, cmdArgs...)
+	stop := context.AfterFunc(interruptContext, func() {
+		logln("Stopping repackage in container ...")
+		if err := execInDockerContainer(containerId, "sh", "-c", `kill -TERM "$(cat "$0")"`, pidFile); err != nil {
+			logf("Warning: failed to stop repackage in container: %v\n", err)
+		}
+	})
+	defer stop()
+	forwarder := &eventForwarder{events: events}
+	if err := execInDockerContainerAt(containerId, jobDir, forwarder, logWriter(), execArgs...); err != nil {
+		if forwarder.err != nil {
+			return nil, forwarder.err
+		}
+		return nil, fmt.Errorf("failed to execute repackage in container: %v", err)
+	}
+	if len(forwarder.artifacts) == 0 {
+		return nil, fmt.Errorf("no packaged file reported by repackage in container")
 	}
-	return strings.ToLower(strings.TrimSpace(string(output)))
-}
 
-// 获取硬件架构
-func getArchName() string {
-	cmd := exec.Command("uname", "-m")
-	output, err := cmd.Output()
-	if err != nil {
-		return "unknown"
+	// 从容器中复制打包后的文件到本地
+	events.stage(stageCopyBack)
+	var outputPaths []string
+	for _, artifact := range forwarder.artifacts {
+		if path.Dir(artifact) != jobDir {
+			return outputPaths, fmt.Errorf("unexpected packaged file outside of the container workspace: %s", artifact)
+		}
+		outputPath, err := copyPackagedFileFromContainer(containerId, artifact)
+		if err != nil {
+			return outputPaths, err
+		}
+		if lockEnabled() {
+			if err := client.copyFromContainer(containerId, lockFilePath(artifact), lockFilePath(outputPath)); err != nil {
+				return outputPaths, fmt.Errorf("failed to copy lock file from container: %v", err)
+			}
+		}
+		outputPaths = append(outputPaths, outputPath)
 	}
-	return strings.TrimSpace(string(output))
+	return outputPaths, nil
 }
 
-// 从Docker容器复制打包后的文件到本地
-func copyPackagedFileFromContainer(containerId, containerWorkDir, findPattern string) error {
-	// 查找生成的文件
-	fmt.Printf("Searching for file pattern: %s\n", findPattern)
-	findCmd := exec.Command("docker", "exec", containerId, "find", containerWorkDir, "-name", findPattern)
-	output, err := findCmd.Output()
-	if err != nil {
-		return fmt.Errorf("Failed to find packaged file in container: %v", err)
+// 容器内repackage的命令参数，始终输出JSON事件以便获取离线包路径，使用targets指定的目标平台以及与宿主机相同的Python版本和文件名模板；宿主机禁用缓存时容器内也不使用缓存，
+// 指定了离线依赖目录和锁定文件时使用其在容器内的位置
+func containerRepackageArgs(containerCache, containerWheelhouse, containerLockFile string, targets []string, command string, args ...string) []string {
+	cmdArgs := []string{"--output", outputJSON, "--exec", execModeInDocker}
+	cmdArgs = append(cmdArgs, pipSettings.args()...)
+	if cacheDir == "" {
+		cmdArgs = append(cmdArgs, "--no-cache")
+	} else {
+		cmdArgs = append(cmdArgs, "--cache-dir", containerCache)
 	}
-
-	// 获取完整的文件路径 - 只取第一行
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(lines) == 0 || lines[0] == "" {
-		return fmt.Errorf("No packaged file found in container")
+	if wheelhouseDir != "" {
+		cmdArgs = append(cmdArgs, "--wheelhouse", containerWheelhouse)
+	}
+	if nameTemplate != "" {
+		cmdArgs = append(cmdArgs, "--name-template", nameTemplate)
+	}
+	if lockFileFlag != "" {
+		cmdArgs = append(cmdArgs, "--lock-file", containerLockFile)
+	} else if lockRequirements {
+		cmdArgs = append(cmdArgs, "--lock")
 	}
+	if len(targets) > 0 {
+		cmdArgs = append(cmdArgs, "--target", strings.Join(targets, ","))
+	}
+	if pythonVersionFlag != "" {
+		cmdArgs = append(cmdArgs, "--python-version", pythonVersionFlag)
+	}
+	cmdArgs = append(cmdArgs, command)
+	return append(cmdArgs, args...)
+}
 
-	containerFilePath := lines[0]
-	if len(lines) > 1 {
-		fmt.Printf("Warning: Found multiple matching files, using the first one: %s\n", containerFilePath)
+// 从Docker容器复制打包后的文件到输出目录，返回本地文件路径
+func copyPackagedFileFromContainer(containerId, containerFilePath string) (string, error) {
+	client, err := getDockerClient()
+	if err != nil {
+		return "", err
 	}
 
 	// 获取文件名（保留平台信息）
-	containerFileName := filepath.Base(containerFilePath)
-	fmt.Printf("Found packaged file in container: %s\n", containerFileName)
-
-	// 从容器复制回本地
-	fmt.Printf("Copying file from container: %s to local directory\n", containerFilePath)
-	cmd := exec.Command("docker", "cp",
-		fmt.Sprintf("%s:%s", containerId, containerFilePath),
-		"./")
+	localPath := filepath.Join(outputDir, path.Base(containerFilePath))
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("Failed to copy package from container: %v", err)
+	logf("Copying file from container: %s to %s\n", containerFilePath, outputDir)
+	if err := client.copyFromContainer(containerId, containerFilePath, localPath); err != nil {
+		return "", fmt.Errorf("failed to copy package from container: %v", err)
 	}
 
-	fmt.Printf("Repackaged file copied to current directory: %s\n", containerFileName)
-	return nil
+	logf("Repackaged file: %s\n", localPath)
+	return localPath, nil
 }
 
 // cleanFileName 清理文件名，去掉空格和特殊字符，保留字母、数字、下划线、连字符和点号
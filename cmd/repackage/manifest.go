@@ -0,0 +1,178 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// 插件包中描述插件信息的文件
+const manifestFile = "manifest.yaml"
+
+var errManifestNotFound = errors.New(manifestFile + " not found in plugin package")
+
+// pluginManifest 插件包中manifest.yaml的内容，只解析重新打包需要的字段
+type pluginManifest struct {
+	Version string              `yaml:"version"`
+	Type    string              `yaml:"type"`
+	Author  string              `yaml:"author"`
+	Name    string              `yaml:"name"`
+	Plugins map[string][]string `yaml:"plugins"`
+	Meta    struct {
+		Version string   `yaml:"version"`
+		Arch    []string `yaml:"arch"`
+		Runner  struct {
+			Language   string `yaml:"language"`
+			Version    string `yaml:"version"`
+			Entrypoint string `yaml:"entrypoint"`
+		} `yaml:"runner"`
+	} `yaml:"meta"`
+}
+
+// inspectReport inspect命令输出的插件信息
+type inspectReport struct {
+	Package       string   `json:"package"`
+	Author        string   `json:"author"`
+	Name          string   `json:"name"`
+	Version       string   `json:"version"`
+	Type          string   `json:"type"`
+	Plugins       []string `json:"plugins"`
+	Language      string   `json:"language"`
+	PythonVersion string   `json:"python_version,omitempty"`
+	Entrypoint    string   `json:"entrypoint"`
+	Arch          []string `json:"arch,omitempty"`
+}
+
+// 从difypkg中读取manifest.yaml，不需要解压整个插件包
+func readManifest(pkgPath string) (*pluginManifest, error) {
+	reader, err := zip.OpenReader(pkgPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package %s: %v", pkgPath, err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.Name != manifestFile {
+			continue
+		}
+
+		src, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer src.Close()
+
+		content, err := io.ReadAll(src)
+		if err != nil {
+			return nil, err
+		}
+
+		var manifest pluginManifest
+		if err := yaml.Unmarshal(content, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", manifestFile, err)
+		}
+		return &manifest, nil
+	}
+	return nil, errManifestNotFound
+}
+
+// 只有Python插件有需要离线打包的依赖
+func (m *pluginManifest) validate() error {
+	language := m.Meta.Runner.Language
+	if language != "" && !strings.EqualFold(language, "python") {
+		return fmt.Errorf("plugin %s uses the %s runner, only Python plugins can be repackaged", m.Name, language)
+	}
+	return nil
+}
+
+// 插件提供的能力，如tools、models
+func (m *pluginManifest) pluginKinds() []string {
+	var kinds []string
+	for kind, files := range m.Plugins {
+		if len(files) > 0 {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// 用manifest.yaml中的作者、名称和版本补充命令行参数得到的插件信息，默认文件名保持不变
+func (id packageIdentity) withManifest(m *pluginManifest) packageIdentity {
+	if m.Author != "" {
+		id.Author = m.Author
+	}
+	if m.Name != "" {
+		id.Name = m.Name
+	}
+	if m.Version != "" {
+		id.Version = m.Version
+	}
+	return id
+}
+
+// 处理inspect命令：输出插件包中manifest.yaml的信息
+func handleInspectCommand(cmd *cobra.Command, args []string) {
+	pkgPath := args[0]
+	if _, err := os.Stat(pkgPath); err != nil {
+		logf("Error: file %s does not exist\n", pkgPath)
+		os.Exit(1)
+	}
+
+	manifest, err := readManifest(pkgPath)
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := inspectReport{
+		Package:       pkgPath,
+		Author:        manifest.Author,
+		Name:          manifest.Name,
+		Version:       manifest.Version,
+		Type:          manifest.Type,
+		Plugins:       manifest.pluginKinds(),
+		Language:      manifest.Meta.Runner.Language,
+		PythonVersion: manifest.Meta.Runner.Version,
+		Entrypoint:    manifest.Meta.Runner.Entrypoint,
+		Arch:          manifest.Meta.Arch,
+	}
+	if !strings.EqualFold(report.Language, "python") {
+		report.PythonVersion = ""
+	}
+
+	if jsonOutput() {
+		json.NewEncoder(os.Stdout).Encode(report)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Package:\t%s\n", report.Package)
+	fmt.Fprintf(w, "Author:\t%s\n", report.Author)
+	fmt.Fprintf(w, "Name:\t%s\n", report.Name)
+	fmt.Fprintf(w, "Version:\t%s\n", report.Version)
+	fmt.Fprintf(w, "Type:\t%s\n", report.Type)
+	fmt.Fprintf(w, "Plugins:\t%s\n", strings.Join(report.Plugins, ", "))
+	fmt.Fprintf(w, "Runner:\t%s\n", report.Language)
+	if report.PythonVersion != "" {
+		fmt.Fprintf(w, "Python:\t%s\n", report.PythonVersion)
+	}
+	fmt.Fprintf(w, "Entrypoint:\t%s\n", report.Entrypoint)
+	if len(report.Arch) > 0 {
+		fmt.Fprintf(w, "Arch:\t%s\n", strings.Join(report.Arch, ", "))
+	}
+	w.Flush()
+
+	if err := manifest.validate(); err != nil {
+		logf("Warning: %v\n", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 插件来源
+const (
+	sourceLocal  = "local"
+	sourceMarket = "market"
+	sourceGithub = "github"
+)
+
+var (
+	outputDirFlag string // 由--output-dir参数设置
+	nameTemplate  string // 由--name-template参数设置，为空时沿用按来源区分的默认文件名
+
+	// 离线包的输出目录（绝对路径）
+	outputDir string
+)
+
+// 文件名模板中可用的字段，如{author}-{name}-{version}-{platform}
+var nameTemplateFields = map[string]bool{
+	"author":   true,
+	"name":     true,
+	"version":  true,
+	"platform": true,
+	"source":   true,
+}
+
+var (
+	namePlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+	unsafeNameChars        = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// packageIdentity 用于生成离线包文件名的插件信息
+type packageIdentity struct {
+	Author  string
+	Name    string
+	Version string
+	Source  string
+	Base    string // 默认文件名的前缀，如langgenius-agent_0.0.9
+}
+
+// 本地文件的插件信息，只能从文件名得到
+func localIdentity(pkgPath string) packageIdentity {
+	base := strings.TrimSuffix(filepath.Base(pkgPath), filepath.Ext(pkgPath))
+	return packageIdentity{Name: base, Source: sourceLocal, Base: base}
+}
+
+// 市场插件的插件信息
+func marketIdentity(author, name, version string) packageIdentity {
+	return packageIdentity{
+		Author:  author,
+		Name:    name,
+		Version: version,
+		Source:  sourceMarket,
+		Base:    safeFileName(fmt.Sprintf("%s-%s_%s", author, name, version)),
+	}
+}
+
+// GitHub插件的插件信息，作者取仓库所有者
+func githubIdentity(repo, release, asset string) packageIdentity {
+	name := strings.TrimSuffix(asset, ".difypkg")
+	parts := strings.Split(strings.Trim(repo, "/"), "/")
+	author := ""
+	if len(parts) >= 2 {
+		author = parts[len(parts)-2]
+	}
+	return packageIdentity{
+		Author:  author,
+		Name:    name,
+		Version: release,
+		Source:  sourceGithub,
+		Base:    safeFileName(fmt.Sprintf("%s-%s", name, release)),
+	}
+}
+
+// 替换文件名中不安全的字符（包括路径分隔符），避免命令行参数中的../使文件写到目录之外
+func safeFileName(value string) string {
+	return unsafeNameChars.ReplaceAllString(value, "_")
+}
+
+// 校验文件名模板：只能使用已知字段，且不能包含路径分隔符；多个目标平台时必须包含{platform}，否则文件会互相覆盖
+func validateNameTemplate(template string, targets []string) error {
+	if template == "" {
+		return nil
+	}
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("invalid name template %q: must not contain path separators", template)
+	}
+	for _, match := range namePlaceholderPattern.FindAllStringSubmatch(template, -1) {
+		if !nameTemplateFields[match[1]] {
+			return fmt.Errorf("invalid name template %q: unknown field {%s}, available fields: {author}, {name}, {version}, {platform}, {source}", template, match[1])
+		}
+	}
+	if len(targets) > 1 && !strings.Contains(template, "{platform}") {
+		return fmt.Errorf("invalid name template %q: {platform} is required when repackaging for multiple targets", template)
+	}
+	return nil
+}
+
+// 生成目标平台的离线包文件名
+func (id packageIdentity) fileName(template string, target targetPlatform) string {
+	if template == "" {
+		return fmt.Sprintf("%s-%s-offline.difypkg", id.Base, target.id())
+	}
+
+	values := map[string]string{
+		"author":   id.Author,
+		"name":     id.Name,
+		"version":  id.Version,
+		"platform": target.id(),
+		"source":   id.Source,
+	}
+	name := namePlaceholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value := values[strings.Trim(placeholder, "{}")]
+		if value == "" {
+			value = "unknown"
+		}
+		return safeFileName(value)
+	})
+
+	if !strings.HasSuffix(name, ".difypkg") {
+		name += ".difypkg"
+	}
+	return name
+}
+
+// 确定输出目录，未指定时使用当前目录，不存在时创建
+func resolveOutputDir(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %v", err)
+	}
+	return abs, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileNameStaysInOutputDir(t *testing.T) {
+	target := targetPlatform{OS: "linux", Arch: "amd64"}
+	ids := []packageIdentity{
+		marketIdentity("../../tmp", "agent", "0.0.9"),
+		marketIdentity("langgenius", `..\..\agent`, "0.0.9"),
+		githubIdentity("owner/repo", "../../v1", "plugin.difypkg"),
+		githubIdentity("owner/repo", "v1", "../../plugin.difypkg"),
+	}
+	outputDir := t.TempDir()
+	for _, id := range ids {
+		for _, template := range []string{"", "{author}-{name}-{version}"} {
+			name := id.fileName(template, target)
+			if strings.ContainsAny(name, `/\`) {
+				t.Errorf("file name %q for %+v contains a path separator", name, id)
+			}
+			if filepath.Dir(filepath.Join(outputDir, name)) != outputDir {
+				t.Errorf("file name %q escapes the output directory", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 输出格式
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// 事件类型
+const (
+	eventStage        = "stage"
+	eventEnvironment  = "environment"
+	eventContainer    = "container"
+	eventWheel        = "wheel"
+	eventDependencies = "dependencies"
+	eventArtifact     = "artifact"
+	eventError        = "error"
+)
+
+// 执行环境
+const (
+	envInDocker  = "in-docker"
+	envContainer = "container"
+	envEphemeral = "ephemeral"
+	envLocal     = "local"
+)
+
+// 由--output参数设置
+var outputFormat = outputText
+
+// event 是--output json模式下写入标准输出的一行JSON
+type event struct {
+	Type        string `json:"type"`
+	Time        string `json:"time"`
+	Plugin      string `json:"plugin,omitempty"`
+	Stage       string `json:"stage,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	ContainerID string `json:"containerId,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Lock        string `json:"lock,omitempty"`
+	Strategy    string `json:"strategy,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+var eventMu sync.Mutex
+
+// 是否输出结构化事件
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// 日志输出位置：JSON模式下写入标准错误，保证标准输出只包含事件
+func logWriter() io.Writer {
+	if jsonOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// 输出格式化日志
+func logf(format string, args ...interface{}) {
+	fmt.Fprintf(logWriter(), format, args...)
+}
+
+// 输出一行日志
+func logln(args ...interface{}) {
+	fmt.Fprintln(logWriter(), args...)
+}
+
+// 写入一条事件，文本模式下不输出
+func emitEvent(e event) {
+	if !jsonOutput() {
+		return
+	}
+	if e.Time == "" {
+		e.Time = time.Now().Format(time.RFC3339)
+	}
+
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	json.NewEncoder(os.Stdout).Encode(e)
+}
+
+// eventEmitter 写入单次重新打包的事件，批量模式下并发执行的插件通过plugin区分
+type eventEmitter struct {
+	plugin string
+}
+
+// 写入一条事件，附带所属插件
+func (em eventEmitter) emit(e event) {
+	if e.Plugin == "" {
+		e.Plugin = em.plugin
+	}
+	emitEvent(e)
+}
+
+// 报告进入新的阶段
+func (em eventEmitter) stage(stage string) {
+	em.emit(event{Type: eventStage, Stage: stage})
+}
+
+// 报告最终结果：成功时为每个离线包附带路径和sha256，失败时附带失败阶段和错误信息
+func (em eventEmitter) result(outputPaths []string, err error) {
+	if err != nil {
+		e := event{Type: eventError, Message: err.Error()}
+		var repackageErr *RepackageError
+		if errors.As(err, &repackageErr) {
+			e.Stage = repackageErr.Stage
+		}
+		em.emit(e)
+		return
+	}
+
+	for _, outputPath := range outputPaths {
+		e := event{Type: eventArtifact, Path: outputPath}
+		if info, statErr := os.Stat(outputPath); statErr == nil {
+			e.Size = info.Size()
+		}
+		if sum, hashErr := fileSHA256(outputPath); hashErr == nil {
+			e.SHA256 = sum
+		}
+		if _, statErr := os.Stat(lockFilePath(outputPath)); statErr == nil {
+			e.Lock = lockFilePath(outputPath)
+		}
+		em.emit(e)
+	}
+}
+
+// eventForwarder 解析容器内repackage输出的事件并转发，其他内容作为日志输出
+type eventForwarder struct {
+	events    eventEmitter
+	buf       strings.Builder
+	artifacts []string        // 容器内生成的离线包路径
+	err       *RepackageError // 容器内报告的错误
+}
+
+func (f *eventForwarder) Write(p []byte) (int, error) {
+	f.buf.Write(p)
+	content := f.buf.String()
+
+	lastNewline := strings.LastIndexByte(content, '\n')
+	if lastNewline < 0 {
+		return len(p), nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content[:lastNewline+1]))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		f.forwardLine(scanner.Text())
+	}
+
+	f.buf.Reset()
+	f.buf.WriteString(content[lastNewline+1:])
+	return len(p), nil
+}
+
+// 只转发阶段和依赖事件，执行环境和最终结果由宿主机侧报告
+func (f *eventForwarder) forwardLine(line string) {
+	var e event
+	if err := json.Unmarshal([]byte(line), &e); err == nil && e.Type != "" {
+		switch e.Type {
+		case eventStage, eventWheel, eventDependencies:
+			f.events.emit(e)
+		case eventArtifact:
+			f.artifacts = append(f.artifacts, e.Path)
+		case eventError:
+			message := strings.TrimPrefix(e.Message, e.Stage+" failed: ")
+			f.err = &RepackageError{Stage: e.Stage, Err: errors.New(message)}
+		}
+		return
+	}
+	logln(line)
+}
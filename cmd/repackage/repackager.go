@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultPipMirrorURL = "https://mirrors.aliyun.com/pypi/simple"
+
+	// 离线安装时requirements.txt的首行
+	offlineRequirementsHeader = "--no-index --find-links=./wheels/"
+)
+
+// 重新打包流程的各个阶段
+const (
+	stageDownload    = "download"
+	stageManifest    = "manifest"
+	stageUnzip       = "unzip"
+	stagePipDownload = "pip download"
+	stagePackage     = "package"
+	stageCopyBack    = "copy-back"
+)
+
+var (
+	errRequirementsNotFound = errors.New("requirements.txt, uv.lock or pyproject.toml not found in plugin package")
+	errPipNotFound          = errors.New("pip not found, please install Python and pip")
+)
+
+// RepackageError 记录失败的阶段，便于调用方区分错误类型
+type RepackageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *RepackageError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Stage, e.Err)
+}
+
+func (e *RepackageError) Unwrap() error {
+	return e.Err
+}
+
+// repackager 在当前进程内完成解压、下载依赖、修改配置和重新压缩
+type repackager struct {
+	outputDir     string           // 输出目录
+	targets       []targetPlatform // 目标平台，为空时使用当前运行平台
+	pythonVersion string           // 目标Python版本，来自--python-version或manifest.yaml，为空时交叉打包使用默认版本
+	pip           pipConfig        // pip索引配置
+	cache         *wheelCache      // 依赖缓存，为nil时不使用缓存
+	wheelhouse    string           // 离线依赖目录，设置后只从该目录解析依赖
+	nameTemplate  string           // 离线包文件名模板，为空时使用默认文件名
+	lock          bool             // 是否生成带sha256的锁定依赖列表
+	lockFile      string           // 已有的锁定文件，设置后按其中的版本和sha256下载依赖
+	events        eventEmitter     // 事件输出
+}
+
+// 根据当前运行环境和命令行参数创建repackager
+func newRepackager(outputDir string, events eventEmitter) (*repackager, error) {
+	targets, err := parseTargets(targetFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &repackager{
+		outputDir:     outputDir,
+		targets:       targets,
+		pythonVersion: pythonVersionFlag,
+		pip:           pipSettings,
+		wheelhouse:    wheelhouseDir,
+		nameTemplate:  nameTemplate,
+		lock:          lockEnabled(),
+		lockFile:      lockFileFlag,
+		events:        events,
+	}
+
+	// 缓存不可用时仍然可以在线下载，只给出警告
+	if cacheDir != "" {
+		if r.cache, err = openWheelCache(cacheDir); err != nil {
+			logf("Warning: %v, continuing without cache\n", err)
+		}
+	}
+	return r, nil
+}
+
+// 按命令类型下载（如需要）并重新打包，返回生成的离线包路径
+func (r *repackager) run(command string, args ...string) ([]string, error) {
+	tempDir, err := os.MkdirTemp("", "dify-repackage-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	var pkgPath string
+	var identity packageIdentity
+	switch command {
+	case "local":
+		pkgPath = args[0]
+		identity = localIdentity(pkgPath)
+	case "market":
+		r.events.stage(stageDownload)
+		pkgPath, err = downloadFromMarket(tempDir, args[0], args[1], args[2])
+		identity = marketIdentity(args[0], args[1], args[2])
+	case "github":
+		r.events.stage(stageDownload)
+		pkgPath, err = downloadFromGithub(tempDir, args[0], args[1], args[2])
+		identity = githubIdentity(args[0], args[1], args[2])
+	default:
+		return nil, fmt.Errorf("unknown command: %s", command)
+	}
+	if err != nil {
+		return nil, &RepackageError{Stage: stageDownload, Err: err}
+	}
+
+	// 插件信息以manifest.yaml为准，缺少manifest.yaml时沿用命令行参数或文件名
+	r.events.stage(stageManifest)
+	manifest, err := readManifest(pkgPath)
+	switch {
+	case errors.Is(err, errManifestNotFound):
+		logf("Warning: %v, using plugin information from the command line\n", err)
+	case err != nil:
+		return nil, &RepackageError{Stage: stageManifest, Err: err}
+	default:
+		if err := manifest.validate(); err != nil {
+			return nil, &RepackageError{Stage: stageManifest, Err: err}
+		}
+		identity = identity.withManifest(manifest)
+		logf("Plugin: %s/%s %s\n", identity.Author, identity.Name, identity.Version)
+
+		// 未通过--python-version指定时使用插件声明的运行时版本
+		if r.pythonVersion == "" {
+			if version, ok := normalizePythonVersion(manifest.Meta.Runner.Version); ok {
+				r.pythonVersion = version
+			}
+		}
+	}
+
+	return r.repackage(pkgPath, tempDir, identity)
+}
+
+// 为每个目标平台重新打包difypkg文件，workDir用于存放解压后的插件目录，identity用于生成离线包文件名
+func (r *repackager) repackage(pkgPath, workDir string, identity packageIdentity) ([]string, error) {
+	if len(r.targets) == 0 {
+		outputPath, err := r.repackageFor(pkgPath, workDir, identity, hostPlatform(), false)
+		if err != nil {
+			return nil, err
+		}
+		return []string{outputPath}, nil
+	}
+
+	var outputPaths []string
+	for _, target := range r.targets {
+		logf("==> Target platform: %s\n", target)
+		outputPath, err := r.repackageFor(pkgPath, filepath.Join(workDir, target.id()), identity, target, true)
+		if err != nil {
+			return outputPaths, err
+		}
+		outputPaths = append(outputPaths, outputPath)
+	}
+	return outputPaths, nil
+}
+
+// 为单个平台重新打包，cross为true时按目标平台下载二进制依赖
+func (r *repackager) repackageFor(pkgPath, workDir string, identity packageIdentity, target targetPlatform, cross bool) (string, error) {
+	packageName := strings.TrimSuffix(filepath.Base(pkgPath), filepath.Ext(pkgPath))
+	pluginDir := filepath.Join(workDir, packageName)
+
+	r.events.stage(stageUnzip)
+	logln("Unziping ...")
+	if err := unzipPackage(pkgPath, pluginDir); err != nil {
+		return "", &RepackageError{Stage: stageUnzip, Err: err}
+	}
+	logln("Unzip success.")
+
+	r.events.stage(stagePipDownload)
+
+	// 按锁定文件重新打包时，pip会校验每个文件的sha256
+	strategy := strategyLockFile
+	if r.lockFile != "" {
+		logf("Using lock file %s\n", r.lockFile)
+		if err := copyFile(r.lockFile, filepath.Join(pluginDir, "requirements.txt"), 0644); err != nil {
+			return "", &RepackageError{Stage: stagePipDownload, Err: err}
+		}
+	} else {
+		var err error
+		if strategy, err = prepareRequirements(pluginDir); err != nil {
+			return "", &RepackageError{Stage: stagePipDownload, Err: err}
+		}
+	}
+	logf("Dependencies resolved from: %s\n", strategy)
+	r.events.emit(event{Type: eventDependencies, Strategy: strategy})
+
+	logln("Repackaging ...")
+	if err := r.downloadWheels(pluginDir, target, cross); err != nil {
+		return "", &RepackageError{Stage: stagePipDownload, Err: err}
+	}
+	r.reportWheels(filepath.Join(pluginDir, "wheels"))
+
+	r.events.stage(stagePackage)
+	var locked []lockedRequirement
+	if r.lock {
+		var err error
+		if locked, err = lockWheels(filepath.Join(pluginDir, "wheels")); err != nil {
+			return "", &RepackageError{Stage: stagePackage, Err: err}
+		}
+		if err := writeLockedRequirements(pluginDir, locked); err != nil {
+			return "", &RepackageError{Stage: stagePackage, Err: err}
+		}
+	}
+	if err := rewriteRequirements(pluginDir); err != nil {
+		return "", &RepackageError{Stage: stagePackage, Err: err}
+	}
+	if err := removeWheelsFromIgnore(pluginDir); err != nil {
+		return "", &RepackageError{Stage: stagePackage, Err: err}
+	}
+
+	outputPath := filepath.Join(r.outputDir, identity.fileName(r.nameTemplate, target))
+	logf("Packaging with platform identifier: %s\n", target.id())
+	if err := zipPackage(pluginDir, outputPath); err != nil {
+		return "", &RepackageError{Stage: stagePackage, Err: err}
+	}
+
+	if r.lock {
+		pythonVersion := r.pythonVersion
+		if cross {
+			pythonVersion = r.targetPythonVersion()
+		}
+		lockPath, err := writeLockFile(outputPath, identity, target, pythonVersion, locked)
+		if err != nil {
+			return "", &RepackageError{Stage: stagePackage, Err: err}
+		}
+		logf("Lock file: %s\n", lockPath)
+	}
+
+	logln("Repackage success.")
+	return outputPath, nil
+}
+
+// 目标Python版本，未指定时使用与dify-plugin-daemon一致的默认版本
+func (r *repackager) targetPythonVersion() string {
+	if r.pythonVersion != "" {
+		return r.pythonVersion
+	}
+	return defaultTargetPythonVersion
+}
+
+// 交叉打包时的pip参数：只下载目标平台和Python版本（CPython）的二进制包
+func (r *repackager) crossPlatformArgs(target targetPlatform) []string {
+	version := r.targetPythonVersion()
+	args := target.pipPlatformArgs()
+	args = append(args,
+		"--python-version", version,
+		"--implementation", "cp",
+		"--abi", "cp"+strings.ReplaceAll(version, ".", ""),
+		"--only-binary=:all:",
+	)
+	return args
+}
+
+// 使用pip下载requirements.txt中的全部依赖到wheels目录，cross为true时按目标平台下载二进制依赖
+func (r *repackager) downloadWheels(pluginDir string, target targetPlatform, cross bool) error {
+	if _, err := os.Stat(filepath.Join(pluginDir, "requirements.txt")); os.IsNotExist(err) {
+		return errRequirementsNotFound
+	}
+
+	pip, err := findPip()
+	if err != nil {
+		return err
+	}
+
+	// pip所在的Python与插件运行时版本不一致时，按目标版本下载当前平台的二进制包
+	if !cross && r.pythonVersion != "" {
+		if hostVersion := pipPythonVersion(pip); hostVersion != r.pythonVersion {
+			if hostVersion == "" {
+				hostVersion = "unknown version"
+			}
+			logf("pip runs on Python %s, downloading wheels for Python %s\n", hostVersion, r.pythonVersion)
+			cross = true
+		}
+	}
+
+	if !cross {
+		if err := r.fetchWheels(pip, pluginDir, target, cross, nil, nil); err != nil {
+			return err
+		}
+		// 源码包在本地构建为wheel，避免在离线的daemon上编译
+		r.buildDownloadedSdists(pip, pluginDir)
+		return nil
+	}
+
+	// 交叉打包时只有源码包的依赖无法通过--only-binary下载，在本地构建为纯Python wheel后重试
+	builder := &sdistBuilder{r: r, pip: pip, dir: filepath.Join(filepath.Dir(pluginDir), "sdist-wheels"), target: target}
+	if err := os.MkdirAll(builder.dir, 0755); err != nil {
+		return err
+	}
+	extraArgs := append(r.crossPlatformArgs(target), "--find-links", builder.dir)
+	for {
+		var output bytes.Buffer
+		err := r.fetchWheels(pip, pluginDir, target, cross, extraArgs, &output)
+		if err == nil {
+			return nil
+		}
+
+		// 没有新构建出wheel时说明失败与源码包无关
+		built, buildErr := builder.buildMissing(output.String())
+		if buildErr != nil {
+			return buildErr
+		}
+		if !built {
+			return err
+		}
+	}
+}
+
+// 下载依赖到wheels目录：指定了离线依赖目录时只从该目录解析，否则优先使用缓存；pip的输出同时写入capture（可以为nil）
+func (r *repackager) fetchWheels(pip []string, pluginDir string, target targetPlatform, cross bool, extraArgs []string, capture io.Writer) error {
+	stdout, stderr := logWriter(), io.Writer(os.Stderr)
+	if capture != nil {
+		stdout, stderr = io.MultiWriter(stdout, capture), io.MultiWriter(stderr, capture)
+	}
+
+	if r.wheelhouse != "" {
+		return r.resolveFromWheelhouse(pip, pluginDir, target, cross, extraArgs, stdout, stderr)
+	}
+
+	// 缓存中已有全部依赖时直接离线解析，不访问网络
+	if r.cache != nil {
+		viewDir, cleanup, err := r.cache.linkView()
+		if err != nil {
+			logf("Warning: failed to read wheel cache: %v\n", err)
+		} else {
+			defer cleanup()
+
+			var output bytes.Buffer
+			offlineArgs := append([]string{"--no-index", "--find-links", viewDir}, extraArgs...)
+			if err := r.runPipDownload(pip, pluginDir, offlineArgs, &output, &output); err == nil {
+				logln("All requirements resolved from wheel cache")
+				r.storeWheels(pluginDir)
+				return nil
+			}
+			if interrupted() {
+				return errInterrupted
+			}
+
+			logln("Wheel cache is incomplete, downloading missing requirements...")
+			extraArgs = append([]string{"--find-links", viewDir}, extraArgs...)
+		}
+	}
+
+	if err := r.runPipDownload(pip, pluginDir, extraArgs, stdout, stderr); err != nil {
+		return fmt.Errorf("pip download: %v", err)
+	}
+	r.storeWheels(pluginDir)
+	return nil
+}
+
+// 只从离线依赖目录解析依赖，失败时列出无法满足的依赖和平台不匹配的依赖
+func (r *repackager) resolveFromWheelhouse(pip []string, pluginDir string, target targetPlatform, cross bool, extraArgs []string, stdout, stderr io.Writer) error {
+	logf("Resolving requirements from wheelhouse %s (no network) ...\n", r.wheelhouse)
+
+	var output bytes.Buffer
+	args := append([]string{"--no-index", "--find-links", r.wheelhouse}, extraArgs...)
+	err := r.runPipDownload(pip, pluginDir, args, io.MultiWriter(stdout, &output), io.MultiWriter(stderr, &output))
+	if err == nil || interrupted() {
+		return err
+	}
+
+	// 只有交叉打包时目标Python版本是确定的
+	pythonVersion := ""
+	if cross {
+		pythonVersion = r.targetPythonVersion()
+	}
+	problems, diagErr := diagnoseWheelhouse(filepath.Join(pluginDir, "requirements.txt"), r.wheelhouse, target, pythonVersion, output.String())
+	if diagErr != nil || len(problems) == 0 {
+		return fmt.Errorf("pip download from wheelhouse %s: %v", r.wheelhouse, err)
+	}
+	return &wheelhouseError{dir: r.wheelhouse, problems: problems}
+}
+
+// 执行pip download，输出写入stdout和stderr
+func (r *repackager) runPipDownload(pip []string, pluginDir string, extraArgs []string, stdout, stderr io.Writer) error {
+	args := []string{"download",
+		"-r", "requirements.txt",
+		"-d", "./wheels",
+	}
+	return r.runPip(pip, pluginDir, append(args, extraArgs...), stdout, stderr)
+}
+
+// 在dir中执行pip命令，输出写入stdout和stderr
+func (r *repackager) runPip(pip []string, dir string, pipArgs []string, stdout, stderr io.Writer) error {
+	args := append(append([]string{}, pip[1:]...), pipArgs...)
+
+	// 索引地址和凭据通过环境变量传递，避免凭据出现在进程参数中；中断时终止pip
+	cmd := exec.CommandContext(interruptContext, pip[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), r.pip.env()...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// 将下载的依赖存入缓存，失败时只给出警告
+func (r *repackager) storeWheels(pluginDir string) {
+	if r.cache == nil {
+		return
+	}
+	if err := r.cache.store(filepath.Join(pluginDir, "wheels")); err != nil && !os.IsNotExist(err) {
+		logf("Warning: failed to update wheel cache: %v\n", err)
+	}
+}
+
+// 报告下载到wheels目录中的依赖
+func (r *repackager) reportWheels(wheelsDir string) {
+	entries, err := os.ReadDir(wheelsDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		e := event{Type: eventWheel, Name: entry.Name()}
+		if info, err := entry.Info(); err == nil {
+			e.Size = info.Size()
+		}
+		r.events.emit(e)
+	}
+}
+
+// 查找可用的pip命令，返回命令及其前置参数
+func findPip() ([]string, error) {
+	for _, name := range []string{"pip", "pip3"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return []string{path}, nil
+		}
+	}
+	for _, name := range []string{"python3", "python"} {
+		if path, err := exec.LookPath(name); err == nil {
+			if exec.Command(path, "-m", "pip", "--version").Run() == nil {
+				return []string{path, "-m", "pip"}, nil
+			}
+		}
+	}
+	return nil, errPipNotFound
+}
+
+// pip所在Python的版本（如3.12），无法获取时返回空字符串
+func pipPythonVersion(pip []string) string {
+	args := append(append([]string{}, pip[1:]...), "--version")
+	output, err := exec.Command(pip[0], args...).Output()
+	if err != nil {
+		return ""
+	}
+	if match := pipPythonPattern.FindSubmatch(output); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
+
+// 在requirements.txt首行加入离线安装参数
+func rewriteRequirements(pluginDir string) error {
+	reqPath := filepath.Join(pluginDir, "requirements.txt")
+	content, err := os.ReadFile(reqPath)
+	if err != nil {
+		return err
+	}
+
+	firstLine, _, _ := strings.Cut(string(content), "\n")
+	if strings.TrimSpace(firstLine) == offlineRequirementsHeader {
+		return nil
+	}
+
+	return os.WriteFile(reqPath, []byte(offlineRequirementsHeader+"\n"+string(content)), 0644)
+}
+
+// 删除忽略文件中排除wheels目录的规则，保证依赖被打包
+func removeWheelsFromIgnore(pluginDir string) error {
+	ignorePath := ignoreFilePath(pluginDir)
+	if ignorePath == "" {
+		return nil
+	}
+
+	file, err := os.Open(ignorePath)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "wheels/") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(ignorePath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sdistBuilder 交叉打包时为只有源码包的依赖在本地构建wheel，只有纯Python的wheel可以用于其他平台
+type sdistBuilder struct {
+	r      *repackager
+	pip    []string
+	dir    string // 构建出的纯Python wheel，作为pip的--find-links
+	target targetPlatform
+	built  map[string]bool // 已构建的包名，避免重复构建
+}
+
+// nativeSdistError 含有原生扩展、无法交叉构建的依赖
+type nativeSdistError struct {
+	target   targetPlatform
+	problems []string
+}
+
+func (e *nativeSdistError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "requirements only available as source distributions cannot be built for %s:", e.target)
+	for _, problem := range e.problems {
+		b.WriteString("\n  - ")
+		b.WriteString(problem)
+	}
+	return b.String()
+}
+
+// 纯Python的wheel，如py3-none-any
+func (w wheelFile) pure() bool {
+	return !w.Sdist && w.ABI == "none" && w.Platform == "any"
+}
+
+// 获取源码包和构建依赖时使用的pip参数，指定了离线依赖目录时只从该目录查找
+func (r *repackager) sourceArgs() []string {
+	if r.wheelhouse != "" {
+		return []string{"--no-index", "--find-links", r.wheelhouse}
+	}
+	return nil
+}
+
+// 根据pip的输出为缺少二进制包的依赖构建wheel，返回是否构建出新的wheel；含有原生扩展的依赖返回nativeSdistError
+func (b *sdistBuilder) buildMissing(pipOutput string) (bool, error) {
+	if b.built == nil {
+		b.built = map[string]bool{}
+	}
+
+	var problems []string
+	built := false
+	for _, match := range noDistributionLine.FindAllStringSubmatch(pipOutput, -1) {
+		req := strings.TrimRight(match[1], ".")
+		name := requirementPattern.FindStringSubmatch(req)
+		if name == nil || b.built[normalizePackageName(name[1])] {
+			continue
+		}
+		b.built[normalizePackageName(name[1])] = true
+
+		logf("No binary wheel of %s for %s, building it from the source distribution ...\n", req, b.target)
+		wheel, err := b.build(req)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", req, err))
+		case !wheel.pure():
+			problems = append(problems, fmt.Sprintf("%s: contains native extensions (built %s on this host), a binary wheel for %s is required", req, wheel.FileName, b.target))
+		default:
+			logf("Built pure Python wheel %s\n", wheel.FileName)
+			built = true
+		}
+	}
+
+	if len(problems) > 0 {
+		return false, &nativeSdistError{target: b.target, problems: problems}
+	}
+	return built, nil
+}
+
+// 下载依赖的源码包并构建wheel，纯Python的wheel放入构建目录
+func (b *sdistBuilder) build(req string) (wheelFile, error) {
+	srcDir := filepath.Join(b.dir, "src")
+	outDir := filepath.Join(b.dir, "out")
+	for _, dir := range []string{srcDir, outDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return wheelFile{}, err
+		}
+	}
+
+	// 只对该依赖禁用二进制包，构建依赖（如setuptools）仍然可以使用wheel
+	name := req
+	if match := requirementPattern.FindStringSubmatch(req); match != nil {
+		name = match[1]
+	}
+
+	var output bytes.Buffer
+	args := append([]string{"download", "--no-deps", "--no-binary", name, "-d", srcDir}, b.r.sourceArgs()...)
+	if err := b.r.runPip(b.pip, b.dir, append(args, req), &output, &output); err != nil {
+		return wheelFile{}, fmt.Errorf("failed to download source distribution: %s", lastLines(output.String(), 3))
+	}
+
+	sdist, err := findDistribution(srcDir, name, true)
+	if err != nil {
+		return wheelFile{}, err
+	}
+
+	wheel, err := b.r.buildWheel(b.pip, filepath.Join(srcDir, sdist.FileName), outDir)
+	if err != nil {
+		return wheelFile{}, err
+	}
+	if wheel.pure() {
+		if err := os.Rename(filepath.Join(outDir, wheel.FileName), filepath.Join(b.dir, wheel.FileName)); err != nil {
+			return wheelFile{}, err
+		}
+	}
+	return wheel, nil
+}
+
+// 用pip wheel将源码包构建为wheel，返回构建出的wheel
+func (r *repackager) buildWheel(pip []string, sdistPath, outDir string) (wheelFile, error) {
+	var output bytes.Buffer
+	args := append([]string{"wheel", "--no-deps", "-w", outDir}, r.sourceArgs()...)
+	if err := r.runPip(pip, outDir, append(args, sdistPath), &output, &output); err != nil {
+		return wheelFile{}, fmt.Errorf("failed to build wheel: %s", lastLines(output.String(), 5))
+	}
+
+	sdist, _ := parseDistributionFileName(filepath.Base(sdistPath))
+	return findDistribution(outDir, sdist.Name, false)
+}
+
+// 在目录中查找指定包的源码包或wheel
+func findDistribution(dir, name string, sdist bool) (wheelFile, error) {
+	name = normalizePackageName(name)
+
+	dists, err := listDistributions(dir)
+	if err != nil {
+		return wheelFile{}, err
+	}
+	for _, dist := range dists {
+		if dist.Name == name && dist.Sdist == sdist {
+			return dist, nil
+		}
+	}
+	return wheelFile{}, fmt.Errorf("no distribution of %s found in %s", name, dir)
+}
+
+// 将下载到wheels目录中的源码包构建为wheel并替换源码包，构建失败时保留源码包并给出警告
+func (r *repackager) buildDownloadedSdists(pip []string, pluginDir string) {
+	wheelsDir := filepath.Join(pluginDir, "wheels")
+	dists, err := listDistributions(wheelsDir)
+	if err != nil {
+		return
+	}
+
+	outDir := filepath.Join(filepath.Dir(pluginDir), "sdist-wheels")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		logf("Warning: %v\n", err)
+		return
+	}
+
+	for _, dist := range dists {
+		if !dist.Sdist {
+			continue
+		}
+
+		logf("Building wheel from source distribution %s ...\n", dist.FileName)
+		wheel, err := r.buildWheel(pip, filepath.Join(wheelsDir, dist.FileName), outDir)
+		if err != nil {
+			logf("Warning: %s will be built during installation: %v\n", dist.FileName, err)
+			continue
+		}
+		if err := os.Rename(filepath.Join(outDir, wheel.FileName), filepath.Join(wheelsDir, wheel.FileName)); err != nil {
+			logf("Warning: %v\n", err)
+			continue
+		}
+		os.Remove(filepath.Join(wheelsDir, dist.FileName))
+
+		if wheel.pure() {
+			logf("Built pure Python wheel %s\n", wheel.FileName)
+		} else {
+			logf("Warning: %s contains native extensions, built %s for this host only\n", dist.FileName, wheel.FileName)
+		}
+	}
+}
+
+// 取输出的最后几行，用于错误信息
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
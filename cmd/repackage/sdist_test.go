@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWheelPure(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     bool
+	}{
+		{"requests-2.32.3-py3-none-any.whl", true},
+		{"six-1.16.0-py2.py3-none-any.whl", true},
+		{"pkg-1.0-1-py3-none-any.whl", true},
+		{"pydantic_core-2.23.4-cp312-cp312-manylinux_2_17_x86_64.whl", false},
+		{"cryptography-43.0.1-cp39-abi3-manylinux_2_28_aarch64.whl", false},
+		{"pkg-1.0-py3-none-linux_x86_64.whl", false},
+		{"pkg-1.0-cp312-none-any.whl", true},
+		{"pkg-1.0.tar.gz", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			wheel, ok := parseDistributionFileName(tt.fileName)
+			if !ok {
+				t.Fatal("file name not parsed")
+			}
+			if got := wheel.pure(); got != tt.want {
+				t.Errorf("pure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 测试进程作为pip运行时的行为：download写入源码包，wheel按包名构建纯Python或原生wheel
+func TestMain(m *testing.M) {
+	if os.Getenv("REPACKAGE_FAKE_PIP") == "1" {
+		os.Exit(fakePip(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func fakePip(args []string) int {
+	flag := func(name string) string {
+		for i, arg := range args {
+			if arg == name && i+1 < len(args) {
+				return args[i+1]
+			}
+		}
+		return ""
+	}
+	last := args[len(args)-1]
+
+	switch args[0] {
+	case "download":
+		name, version, _ := strings.Cut(last, "==")
+		if strings.HasPrefix(name, "missing") {
+			fmt.Fprintf(os.Stderr, "ERROR: No matching distribution found for %s\n", last)
+			return 1
+		}
+		os.WriteFile(filepath.Join(flag("-d"), name+"-"+version+".tar.gz"), []byte("sdist"), 0644)
+	case "wheel":
+		sdist, _ := parseDistributionFileName(filepath.Base(last))
+		tags := "py3-none-any"
+		if strings.HasPrefix(sdist.Name, "native") {
+			tags = "cp312-cp312-linux_x86_64"
+		}
+		name := strings.ReplaceAll(sdist.Name, "-", "_")
+		os.WriteFile(filepath.Join(flag("-w"), name+"-"+sdist.Version+"-"+tags+".whl"), []byte("wheel"), 0644)
+	default:
+		return 2
+	}
+	return 0
+}
+
+func newFakePipBuilder(t *testing.T) *sdistBuilder {
+	t.Helper()
+	t.Setenv("REPACKAGE_FAKE_PIP", "1")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sdistBuilder{
+		r:      &repackager{},
+		pip:    []string{exe},
+		dir:    t.TempDir(),
+		target: targetPlatform{OS: "linux", Arch: "arm64"},
+	}
+}
+
+func TestSdistBuilderBuildMissing(t *testing.T) {
+	tests := []struct {
+		name       string
+		pipOutput  string
+		wantBuilt  bool
+		wantWheels []string // 构建目录中的纯Python wheel
+		wantErr    []string // nativeSdistError中列出的依赖
+	}{
+		{
+			name:      "nothing missing",
+			pipOutput: "Successfully downloaded requests",
+		},
+		{
+			name:       "pure python sdist",
+			pipOutput:  "ERROR: No matching distribution found for pure-pkg==1.0\n",
+			wantBuilt:  true,
+			wantWheels: []string{"pure_pkg-1.0-py3-none-any.whl"},
+		},
+		{
+			name:      "native extension",
+			pipOutput: "ERROR: No matching distribution found for native-pkg==2.0\n",
+			wantErr:   []string{"native-pkg==2.0: contains native extensions"},
+		},
+		{
+			name: "mixed",
+			pipOutput: "ERROR: No matching distribution found for pure-pkg==1.0\n" +
+				"ERROR: No matching distribution found for native-pkg==2.0.\n",
+			wantWheels: []string{"pure_pkg-1.0-py3-none-any.whl"},
+			wantErr:    []string{"native-pkg==2.0: contains native extensions"},
+		},
+		{
+			name:      "source distribution unavailable",
+			pipOutput: "ERROR: No matching distribution found for missing-pkg==1.0\n",
+			wantErr:   []string{"missing-pkg==1.0: failed to download source distribution"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := newFakePipBuilder(t)
+			built, err := builder.buildMissing(tt.pipOutput)
+
+			var nativeErr *nativeSdistError
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if built != tt.wantBuilt {
+					t.Errorf("built = %v, want %v", built, tt.wantBuilt)
+				}
+			} else {
+				if !errors.As(err, &nativeErr) {
+					t.Fatalf("err = %v, want nativeSdistError", err)
+				}
+				if len(nativeErr.problems) != len(tt.wantErr) {
+					t.Fatalf("problems = %q, want %q", nativeErr.problems, tt.wantErr)
+				}
+				for i, problem := range nativeErr.problems {
+					if !strings.HasPrefix(problem, tt.wantErr[i]) {
+						t.Errorf("problem %q, want prefix %q", problem, tt.wantErr[i])
+					}
+				}
+				if !strings.Contains(err.Error(), "linux/arm64") {
+					t.Errorf("error does not name the target: %v", err)
+				}
+			}
+
+			// 只有纯Python的wheel放入构建目录供pip使用
+			wheels, _ := filepath.Glob(filepath.Join(builder.dir, "*.whl"))
+			var names []string
+			for _, wheel := range wheels {
+				names = append(names, filepath.Base(wheel))
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantWheels, ",") {
+				t.Errorf("wheels = %v, want %v", names, tt.wantWheels)
+			}
+		})
+	}
+}
+
+func TestSdistBuilderBuildsOnce(t *testing.T) {
+	builder := newFakePipBuilder(t)
+	output := "ERROR: No matching distribution found for pure-pkg==1.0\n"
+
+	if built, err := builder.buildMissing(output); err != nil || !built {
+		t.Fatalf("first build = %v, %v", built, err)
+	}
+	// pip再次报告同一依赖时不再重复构建，由调用方结束重试
+	if built, err := builder.buildMissing(output); err != nil || built {
+		t.Errorf("second build = %v, %v, want false", built, err)
+	}
+}
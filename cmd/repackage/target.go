@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// 交叉打包时默认的Python版本，与dify-plugin-daemon镜像保持一致
+const defaultTargetPythonVersion = "3.12"
+
+var (
+	targetFlags       []string // 由--target参数设置，为空时使用当前运行平台
+	pythonVersionFlag string   // 由--python-version参数设置，优先于manifest.yaml中声明的版本
+)
+
+var (
+	pythonVersionPattern = regexp.MustCompile(`^(\d+)\.(\d+)(\.\d+)?$`)
+	pipPythonPattern     = regexp.MustCompile(`\(python (\d+\.\d+)\)`)
+)
+
+// 将3.12或3.12.1形式的Python版本转换为3.12
+func normalizePythonVersion(version string) (string, bool) {
+	match := pythonVersionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return "", false
+	}
+	return match[1] + "." + match[2], true
+}
+
+// targetPlatform 离线包的目标平台
+type targetPlatform struct {
+	OS   string
+	Arch string
+}
+
+// 各目标平台对应的pip平台标签，pip会自动包含兼容的旧版本标签和纯Python包
+var pipPlatformTags = map[targetPlatform][]string{
+	{OS: "linux", Arch: "amd64"}:  {"manylinux_2_28_x86_64", "manylinux2014_x86_64"},
+	{OS: "linux", Arch: "arm64"}:  {"manylinux_2_28_aarch64", "manylinux2014_aarch64"},
+	{OS: "darwin", Arch: "amd64"}: {"macosx_10_12_x86_64"},
+	{OS: "darwin", Arch: "arm64"}: {"macosx_11_0_arm64"},
+}
+
+// 当前运行平台
+func hostPlatform() targetPlatform {
+	return targetPlatform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+// 形如linux/amd64的表示
+func (t targetPlatform) String() string {
+	return t.OS + "/" + t.Arch
+}
+
+// 输出文件名中的平台标识，形如linux-amd64
+func (t targetPlatform) id() string {
+	return t.OS + "-" + t.Arch
+}
+
+// pip download使用的--platform参数
+func (t targetPlatform) pipPlatformArgs() []string {
+	var args []string
+	for _, tag := range pipPlatformTags[t] {
+		args = append(args, "--platform", tag)
+	}
+	return args
+}
+
+// 解析--target参数，支持逗号分隔和多次指定
+func parseTargets(values []string) ([]targetPlatform, error) {
+	var targets []targetPlatform
+	seen := map[targetPlatform]bool{}
+
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			osName, arch, ok := strings.Cut(item, "/")
+			if !ok {
+				return nil, fmt.Errorf("invalid target %q, expected os/arch such as linux/amd64", item)
+			}
+
+			target := targetPlatform{OS: strings.ToLower(osName), Arch: normalizeArch(arch)}
+			if _, supported := pipPlatformTags[target]; !supported {
+				return nil, fmt.Errorf("unsupported target %q, supported targets: linux/amd64, linux/arm64, darwin/amd64, darwin/arm64", item)
+			}
+
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// 离线包文件名中的平台标识，如plugin-linux-amd64-offline.difypkg
+var offlinePackagePattern = regexp.MustCompile(`-([a-z]+)-([a-z0-9_]+)-offline\.difypkg$`)
+
+// verifyCheck 单项检查结果
+type verifyCheck struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// verifyReport 离线包的检查结果
+type verifyReport struct {
+	Package  string        `json:"package"`
+	Platform string        `json:"platform,omitempty"`
+	Python   string        `json:"python,omitempty"`
+	Passed   bool          `json:"passed"`
+	Checks   []verifyCheck `json:"checks"`
+}
+
+// 处理verify命令
+func handleVerifyCommand(cmd *cobra.Command, args []string) {
+	report, err := verifyPackage(args[0])
+	if err != nil {
+		logf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput() {
+		json.NewEncoder(os.Stdout).Encode(report)
+	} else {
+		printVerifyReport(report)
+	}
+
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
+
+// 从离线包文件名中解析目标平台，未能识别时使用--target指定的第一个平台
+func packagePlatform(pkgPath string) (targetPlatform, bool) {
+	if match := offlinePackagePattern.FindStringSubmatch(filepath.Base(pkgPath)); match != nil {
+		target := targetPlatform{OS: match[1], Arch: normalizeArch(match[2])}
+		if _, ok := wheelArchNames[target.String()]; ok {
+			return target, true
+		}
+	}
+
+	if targets, err := parseTargets(targetFlags); err == nil && len(targets) > 0 {
+		return targets[0], true
+	}
+	return targetPlatform{}, false
+}
+
+// 插件运行时的Python版本：优先使用--python-version，其次为manifest.yaml中声明的版本，都没有时不检查
+func packagePythonVersion(pkgPath string) string {
+	if pythonVersionFlag != "" {
+		return pythonVersionFlag
+	}
+	if manifest, err := readManifest(pkgPath); err == nil {
+		if version, ok := normalizePythonVersion(manifest.Meta.Runner.Version); ok {
+			return version
+		}
+	}
+	return ""
+}
+
+// 解压离线包并检查能否离线安装
+func verifyPackage(pkgPath string) (*verifyReport, error) {
+	if _, err := os.Stat(pkgPath); err != nil {
+		return nil, fmt.Errorf("file %s does not exist", pkgPath)
+	}
+
+	tempDir, err := os.MkdirTemp("", "dify-repackage-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	pluginDir := filepath.Join(tempDir, "plugin")
+	if err := unzipPackage(pkgPath, pluginDir); err != nil {
+		return nil, err
+	}
+
+	report := &verifyReport{Package: pkgPath}
+	target, hasTarget := packagePlatform(pkgPath)
+	if hasTarget {
+		report.Platform = target.String()
+	}
+
+	report.Python = packagePythonVersion(pkgPath)
+
+	report.Checks = append(report.Checks, checkTargetPlatform(target, hasTarget))
+	report.Checks = append(report.Checks, checkRequirementsHeader(pluginDir))
+	report.Checks = append(report.Checks, checkWheelsNotIgnored(pluginDir))
+	report.Checks = append(report.Checks, checkRequirementWheels(pluginDir, target, hasTarget, report.Python)...)
+
+	report.Passed = true
+	for _, check := range report.Checks {
+		if !check.Passed {
+			report.Passed = false
+		}
+	}
+	return report, nil
+}
+
+// 检查能否确定目标平台，无法确定时依赖只按包名和版本检查，不能确认离线包可以安装到目标平台
+func checkTargetPlatform(target targetPlatform, hasTarget bool) verifyCheck {
+	check := verifyCheck{Check: "target platform"}
+	if !hasTarget {
+		check.Detail = "unknown: file name has no -<os>-<arch>-offline.difypkg suffix, pass --target to check platform-specific wheels"
+		return check
+	}
+
+	check.Passed = true
+	check.Detail = target.String()
+	return check
+}
+
+// 检查requirements.txt首行是否为离线安装参数
+func checkRequirementsHeader(pluginDir string) verifyCheck {
+	check := verifyCheck{Check: "requirements header"}
+
+	content, err := os.ReadFile(filepath.Join(pluginDir, "requirements.txt"))
+	if err != nil {
+		check.Detail = "requirements.txt not found"
+		return check
+	}
+
+	firstLine, _, _ := strings.Cut(string(content), "\n")
+	if strings.TrimSpace(firstLine) != offlineRequirementsHeader {
+		check.Detail = fmt.Sprintf("first line is %q, expected %q", strings.TrimSpace(firstLine), offlineRequirementsHeader)
+		return check
+	}
+
+	check.Passed = true
+	return check
+}
+
+// 检查wheels目录存在且没有被.difyignore或.gitignore排除
+func checkWheelsNotIgnored(pluginDir string) verifyCheck {
+	check := verifyCheck{Check: "wheels not ignored"}
+
+	wheels, err := listDistributions(filepath.Join(pluginDir, "wheels"))
+	if err != nil {
+		check.Detail = "wheels/ not found in package"
+		return check
+	}
+
+	matcher, err := loadIgnoreMatcher(pluginDir)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+
+	ignoreFile := filepath.Base(ignoreFilePath(pluginDir))
+	if matcher.match("wheels", true) {
+		check.Detail = fmt.Sprintf("wheels/ is excluded by %s", ignoreFile)
+		return check
+	}
+	for _, wheel := range wheels {
+		if matcher.match("wheels/"+wheel.FileName, false) {
+			check.Detail = fmt.Sprintf("wheels/%s is excluded by %s", wheel.FileName, ignoreFile)
+			return check
+		}
+	}
+
+	check.Passed = true
+	return check
+}
+
+// 检查每个依赖在wheels目录中都有匹配目标平台和Python版本的文件，固定版本的依赖还需版本一致
+func checkRequirementWheels(pluginDir string, target targetPlatform, hasTarget bool, pythonVersion string) []verifyCheck {
+	requirements, err := readRequirements(filepath.Join(pluginDir, "requirements.txt"))
+	if err != nil {
+		return nil
+	}
+
+	dists, _ := listDistributions(filepath.Join(pluginDir, "wheels"))
+	byName := map[string][]wheelFile{}
+	for _, dist := range dists {
+		byName[dist.Name] = append(byName[dist.Name], dist)
+	}
+
+	// 无法确定平台时只检查包名和版本
+	if !hasTarget {
+		target = targetPlatform{}
+	}
+
+	var checks []verifyCheck
+	for _, req := range requirements {
+		check := verifyCheck{Check: "wheel " + req.Line}
+		candidates := byName[req.Name]
+
+		if problem := diagnoseRequirement(req, candidates, target, pythonVersion); problem != "" {
+			check.Detail = strings.TrimPrefix(problem, req.Line+": ")
+		} else {
+			check.Detail = matchingWheel(req, candidates, target, pythonVersion)
+			check.Passed = true
+
+			// 锁定的依赖还需校验文件的sha256，防止wheels目录中的文件被替换
+			if len(req.Hashes) > 0 {
+				sum, err := fileSHA256(filepath.Join(pluginDir, "wheels", check.Detail))
+				if err != nil || !hashListed(req.Hashes, sum) {
+					check.Passed = false
+					check.Detail = fmt.Sprintf("sha256 of %s does not match requirements.txt", check.Detail)
+				}
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// 判断sha256是否在依赖的--hash列表中
+func hashListed(hashes []string, sum string) bool {
+	for _, hash := range hashes {
+		if strings.EqualFold(hash, sum) {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回满足依赖的wheel文件名，用于报告
+func matchingWheel(req requirement, candidates []wheelFile, target targetPlatform, pythonVersion string) string {
+	pinned, isPinned := req.pinnedVersion()
+	for _, candidate := range candidates {
+		if isPinned && !versionMatches(pinned, candidate.Version) {
+			continue
+		}
+		if candidate.platformMatches(target) && (pythonVersion == "" || candidate.pythonMatches(pythonVersion)) {
+			return candidate.FileName
+		}
+	}
+	return ""
+}
+
+// 以表格形式输出检查结果
+func printVerifyReport(report *verifyReport) {
+	platform := report.Platform
+	if platform == "" {
+		platform = "unknown"
+	}
+	fmt.Printf("Package:  %s\n", report.Package)
+	fmt.Printf("Platform: %s\n", platform)
+	if report.Python != "" {
+		fmt.Printf("Python:   %s\n", report.Python)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+	for _, check := range report.Checks {
+		result := "PASS"
+		if !check.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.Check, result, check.Detail)
+	}
+	w.Flush()
+
+	if report.Passed {
+		fmt.Println("\nVerification passed.")
+	} else {
+		fmt.Println("\nVerification failed.")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testWheelContent = "wheel content"
+
+// 生成离线包，files为包内的文件及其内容
+func writeTestPackage(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+	var entries []string
+	for entry := range files {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	pkgPath := filepath.Join(t.TempDir(), name)
+	writeTestZip(t, pkgPath, entries, files)
+	return pkgPath
+}
+
+// 找到名称以prefix开头的检查
+func findCheck(report *verifyReport, prefix string) (verifyCheck, bool) {
+	for _, check := range report.Checks {
+		if strings.HasPrefix(check.Check, prefix) {
+			return check, true
+		}
+	}
+	return verifyCheck{}, false
+}
+
+func TestVerifyPackage(t *testing.T) {
+	sum := sha256.Sum256([]byte(testWheelContent))
+	goodHash := hex.EncodeToString(sum[:])
+	badHash := strings.Repeat("0", 64)
+
+	base := func(requirements string, extra map[string]string) map[string]string {
+		files := map[string]string{
+			"manifest.yaml":    "version: 0.0.1\nmeta:\n  runner:\n    language: python\n    version: \"3.12\"\n",
+			"requirements.txt": requirements,
+			"wheels/requests-2.32.3-py3-none-any.whl":                           testWheelContent,
+			"wheels/pydantic_core-2.23.4-cp312-cp312-manylinux_2_17_x86_64.whl": testWheelContent,
+		}
+		for name, content := range extra {
+			files[name] = content
+		}
+		return files
+	}
+	header := offlineRequirementsHeader + "\n"
+
+	tests := []struct {
+		name      string
+		pkgName   string
+		targets   []string
+		files     map[string]string
+		check     string // 需要确认结果的检查
+		wantCheck bool
+		wantPass  bool
+	}{
+		{
+			name:      "valid package",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     base(header+"requests==2.32.3\npydantic-core==2.23.4\n", nil),
+			check:     "wheel pydantic-core",
+			wantCheck: true,
+			wantPass:  true,
+		},
+		{
+			name:      "missing header",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     base("requests==2.32.3\n", nil),
+			check:     "requirements header",
+			wantCheck: false,
+		},
+		{
+			name:      "missing requirements.txt",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     map[string]string{"wheels/requests-2.32.3-py3-none-any.whl": testWheelContent},
+			check:     "requirements header",
+			wantCheck: false,
+		},
+		{
+			name:      "wheels directory ignored",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     base(header+"requests==2.32.3\n", map[string]string{".difyignore": "wheels/\n"}),
+			check:     "wheels not ignored",
+			wantCheck: false,
+		},
+		{
+			name:      "wheel files ignored by gitignore",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     base(header+"requests==2.32.3\n", map[string]string{".gitignore": "*.whl\n"}),
+			check:     "wheels not ignored",
+			wantCheck: false,
+		},
+		{
+			name:      "wheels kept by negation",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     base(header+"requests==2.32.3\npydantic-core==2.23.4\n", map[string]string{".difyignore": "*.whl\n!wheels/*.whl\n"}),
+			check:     "wheels not ignored",
+			wantCheck: true,
+			wantPass:  true,
+		},
+		{
+			name:      "pinned version mismatch",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     base(header+"requests==2.31.0\n", nil),
+			check:     "wheel requests",
+			wantCheck: false,
+		},
+		{
+			name:      "sha256 matches",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     base(header+"requests==2.32.3 --hash=sha256:"+goodHash+"\n", nil),
+			check:     "wheel requests",
+			wantCheck: true,
+			wantPass:  true,
+		},
+		{
+			name:      "sha256 mismatch",
+			pkgName:   "agent-linux-amd64-offline.difypkg",
+			files:     base(header+"requests==2.32.3 \\\n    --hash=sha256:"+badHash+"\n", nil),
+			check:     "wheel requests",
+			wantCheck: false,
+		},
+		{
+			name:      "platform mismatch",
+			pkgName:   "agent-linux-arm64-offline.difypkg",
+			files:     base(header+"pydantic-core==2.23.4\n", nil),
+			check:     "wheel pydantic-core",
+			wantCheck: false,
+		},
+		{
+			name:      "unknown platform fails",
+			pkgName:   "agent.difypkg",
+			files:     base(header+"requests==2.32.3\npydantic-core==2.23.4\n", nil),
+			check:     "target platform",
+			wantCheck: false,
+		},
+		{
+			name:      "platform from --target",
+			pkgName:   "agent.difypkg",
+			targets:   []string{"linux/amd64"},
+			files:     base(header+"requests==2.32.3\npydantic-core==2.23.4\n", nil),
+			check:     "target platform",
+			wantCheck: true,
+			wantPass:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetFlags, pythonVersionFlag = tt.targets, ""
+			t.Cleanup(func() { targetFlags = nil })
+
+			report, err := verifyPackage(writeTestPackage(t, tt.pkgName, tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			check, ok := findCheck(report, tt.check)
+			if !ok {
+				t.Fatalf("check %q not found in %+v", tt.check, report.Checks)
+			}
+			if check.Passed != tt.wantCheck {
+				t.Errorf("%s passed = %v (%s), want %v", check.Check, check.Passed, check.Detail, tt.wantCheck)
+			}
+			if report.Passed != tt.wantPass {
+				t.Errorf("report passed = %v, want %v: %+v", report.Passed, tt.wantPass, report.Checks)
+			}
+		})
+	}
+}
+
+func TestPackagePlatform(t *testing.T) {
+	tests := []struct {
+		pkgName string
+		targets []string
+		want    string
+		ok      bool
+	}{
+		{pkgName: "agent-linux-amd64-offline.difypkg", want: "linux/amd64", ok: true},
+		{pkgName: "agent-darwin-arm64-offline.difypkg", want: "darwin/arm64", ok: true},
+		{pkgName: "agent-linux-x86_64-offline.difypkg", want: "linux/amd64", ok: true},
+		{pkgName: "agent-linux-amd64-offline.difypkg", targets: []string{"linux/arm64"}, want: "linux/amd64", ok: true},
+		{pkgName: "agent-offline.difypkg", targets: []string{"linux/arm64"}, want: "linux/arm64", ok: true},
+		{pkgName: "agent-offline.difypkg"},
+		{pkgName: "langgenius-agent_0.0.9.difypkg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pkgName, func(t *testing.T) {
+			targetFlags = tt.targets
+			t.Cleanup(func() { targetFlags = nil })
+
+			target, ok := packagePlatform(tt.pkgName)
+			if ok != tt.ok || (ok && target.String() != tt.want) {
+				t.Errorf("packagePlatform(%q) = %v, %v, want %q, %v", tt.pkgName, target, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 由--wheelhouse参数设置，离线环境中预先准备好的依赖目录
+var wheelhouseDir string
+
+// wheelFile 依赖目录中的一个分发文件，sdist没有标签信息
+type wheelFile struct {
+	FileName string
+	Name     string // 按PEP 503规范化后的包名
+	Version  string
+	Python   string
+	ABI      string
+	Platform string
+	Sdist    bool
+}
+
+// requirement requirements.txt中的一条依赖
+type requirement struct {
+	Line      string
+	Name      string // 按PEP 503规范化后的包名
+	Specifier string
+	Hashes    []string // --hash=sha256:指定的文件sha256
+}
+
+var (
+	requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(\[[^\]]*\])?\s*([^;]*)`)
+	nameNormalizer     = regexp.MustCompile(`[-_.]+`)
+	noDistributionLine = regexp.MustCompile(`No matching distribution found for (\S+)`)
+)
+
+// wheelhouseError 依赖目录无法满足requirements.txt时列出的具体问题
+type wheelhouseError struct {
+	dir      string
+	problems []string
+}
+
+func (e *wheelhouseError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "requirements not satisfied by wheelhouse %s:", e.dir)
+	for _, problem := range e.problems {
+		b.WriteString("\n  - ")
+		b.WriteString(problem)
+	}
+	return b.String()
+}
+
+// 按PEP 503规范化包名
+func normalizePackageName(name string) string {
+	return strings.ToLower(nameNormalizer.ReplaceAllString(name, "-"))
+}
+
+// 解析wheel或sdist文件名，无法识别时返回false
+func parseDistributionFileName(fileName string) (wheelFile, bool) {
+	if strings.HasSuffix(fileName, ".whl") {
+		// {name}-{version}(-{build})?-{python}-{abi}-{platform}.whl
+		parts := strings.Split(strings.TrimSuffix(fileName, ".whl"), "-")
+		if len(parts) != 5 && len(parts) != 6 {
+			return wheelFile{}, false
+		}
+		n := len(parts)
+		return wheelFile{
+			FileName: fileName,
+			Name:     normalizePackageName(parts[0]),
+			Version:  parts[1],
+			Python:   parts[n-3],
+			ABI:      parts[n-2],
+			Platform: parts[n-1],
+		}, true
+	}
+
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		if strings.HasSuffix(fileName, ext) {
+			base := strings.TrimSuffix(fileName, ext)
+			i := strings.LastIndex(base, "-")
+			if i <= 0 {
+				return wheelFile{}, false
+			}
+			return wheelFile{
+				FileName: fileName,
+				Name:     normalizePackageName(base[:i]),
+				Version:  base[i+1:],
+				Sdist:    true,
+			}, true
+		}
+	}
+
+	return wheelFile{}, false
+}
+
+// 列出目录中可以识别的分发文件
+func listDistributions(dir string) ([]wheelFile, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var dists []wheelFile
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if dist, ok := parseDistributionFileName(file.Name()); ok {
+			dists = append(dists, dist)
+		}
+	}
+	return dists, nil
+}
+
+// 读取requirements.txt中的依赖，忽略注释、pip选项和URL依赖；支持以反斜杠续行的--hash选项
+func readRequirements(path string) ([]requirement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var requirements []requirement
+	var logical string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if continued, ok := strings.CutSuffix(line, "\\"); ok {
+			logical += continued + " "
+			continue
+		}
+		line = strings.TrimSpace(logical + line)
+		logical = ""
+
+		if req, ok := parseRequirementLine(line); ok {
+			requirements = append(requirements, req)
+		}
+	}
+	return requirements, scanner.Err()
+}
+
+// 解析一条依赖，依赖后面的选项中只保留--hash
+func parseRequirementLine(line string) (requirement, bool) {
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+		return requirement{}, false
+	}
+
+	spec, options, _ := strings.Cut(line, " --")
+	spec = strings.TrimSpace(spec)
+	match := requirementPattern.FindStringSubmatch(spec)
+	if match == nil || strings.Contains(match[3], "@") {
+		return requirement{}, false
+	}
+
+	req := requirement{
+		Line:      spec,
+		Name:      normalizePackageName(match[1]),
+		Specifier: strings.ReplaceAll(strings.TrimSpace(match[3]), " ", ""),
+	}
+	for _, option := range strings.Fields("--" + options) {
+		if hash, ok := strings.CutPrefix(option, "--hash=sha256:"); ok {
+			req.Hashes = append(req.Hashes, hash)
+		}
+	}
+	return req, true
+}
+
+// 固定版本的依赖返回其版本号，如flask==3.0.0
+func (r requirement) pinnedVersion() (string, bool) {
+	if !strings.HasPrefix(r.Specifier, "==") || strings.Contains(r.Specifier, ",") {
+		return "", false
+	}
+	return strings.TrimPrefix(r.Specifier, "=="), true
+}
+
+// 判断版本是否满足固定版本要求，支持==1.2.*形式
+func versionMatches(pinned, version string) bool {
+	if prefix, ok := strings.CutSuffix(pinned, ".*"); ok {
+		return version == prefix || strings.HasPrefix(version, prefix+".")
+	}
+	return version == pinned
+}
+
+// 各目标平台在wheel平台标签中的架构名称
+var wheelArchNames = map[string][]string{
+	"linux/amd64":   {"x86_64"},
+	"linux/arm64":   {"aarch64"},
+	"darwin/amd64":  {"x86_64", "intel", "universal", "universal2"},
+	"darwin/arm64":  {"arm64", "universal2"},
+	"windows/amd64": {"amd64"},
+	"windows/arm64": {"arm64"},
+}
+
+// 判断wheel的平台标签是否可以安装到目标平台，标签可能由多个以点号分隔的平台组成；未指定平台时不检查
+func (w wheelFile) platformMatches(target targetPlatform) bool {
+	if w.Sdist || target == (targetPlatform{}) {
+		return true
+	}
+
+	for _, platform := range strings.Split(w.Platform, ".") {
+		if platform == "any" {
+			return true
+		}
+
+		var prefixes []string
+		switch target.OS {
+		case "linux":
+			prefixes = []string{"manylinux", "linux_"}
+		case "darwin":
+			prefixes = []string{"macosx_"}
+		case "windows":
+			prefixes = []string{"win_"}
+		}
+
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(platform, prefix) {
+				continue
+			}
+			for _, arch := range wheelArchNames[target.String()] {
+				if strings.HasSuffix(platform, "_"+arch) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// 判断wheel的Python和ABI标签是否兼容目标Python版本（如3.12）
+func (w wheelFile) pythonMatches(pythonVersion string) bool {
+	if w.Sdist {
+		return true
+	}
+
+	major, minor, _ := strings.Cut(pythonVersion, ".")
+	target, _ := strconv.Atoi(major + minor)
+
+	for _, tag := range strings.Split(w.Python, ".") {
+		switch {
+		case tag == "py"+major || tag == "py"+major+minor:
+			return true
+		case tag == "cp"+major+minor:
+			return true
+		case strings.HasPrefix(tag, "cp") && w.ABI == "abi3":
+			// abi3的wheel可以安装到不低于其标签的CPython版本
+			if version, err := strconv.Atoi(strings.TrimPrefix(tag, "cp")); err == nil && version <= target {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 分析requirements.txt中哪些依赖无法由依赖目录满足，pipOutput用于补充间接依赖的问题
+func diagnoseWheelhouse(requirementsPath, dir string, target targetPlatform, pythonVersion string, pipOutput string) ([]string, error) {
+	requirements, err := readRequirements(requirementsPath)
+	if err != nil {
+		return nil, err
+	}
+	dists, err := listDistributions(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string][]wheelFile{}
+	for _, dist := range dists {
+		byName[dist.Name] = append(byName[dist.Name], dist)
+	}
+
+	var problems []string
+	reported := map[string]bool{}
+	for _, req := range requirements {
+		if problem := diagnoseRequirement(req, byName[req.Name], target, pythonVersion); problem != "" {
+			problems = append(problems, problem)
+			reported[req.Name] = true
+		}
+	}
+
+	// pip报告的缺失依赖可能是间接依赖
+	for _, match := range noDistributionLine.FindAllStringSubmatch(pipOutput, -1) {
+		req := strings.TrimRight(match[1], ".")
+		name := requirementPattern.FindStringSubmatch(req)
+		if name == nil || reported[normalizePackageName(name[1])] {
+			continue
+		}
+		reported[normalizePackageName(name[1])] = true
+		problems = append(problems, fmt.Sprintf("%s: not found (required by another package)", req))
+	}
+
+	return problems, nil
+}
+
+// 分析单个依赖，没有问题时返回空字符串
+func diagnoseRequirement(req requirement, candidates []wheelFile, target targetPlatform, pythonVersion string) string {
+	if len(candidates) == 0 {
+		return fmt.Sprintf("%s: not found", req.Line)
+	}
+
+	if pinned, ok := req.pinnedVersion(); ok {
+		var matched []wheelFile
+		var versions []string
+		for _, candidate := range candidates {
+			if versionMatches(pinned, candidate.Version) {
+				matched = append(matched, candidate)
+			}
+			versions = append(versions, candidate.Version)
+		}
+		if len(matched) == 0 {
+			return fmt.Sprintf("%s: version not found (available: %s)", req.Line, strings.Join(uniqueSorted(versions), ", "))
+		}
+		candidates = matched
+	}
+
+	var files []string
+	for _, candidate := range candidates {
+		if candidate.platformMatches(target) && (pythonVersion == "" || candidate.pythonMatches(pythonVersion)) {
+			return ""
+		}
+		files = append(files, candidate.FileName)
+	}
+
+	if pythonVersion != "" {
+		return fmt.Sprintf("%s: platform mismatch, no wheel for %s and Python %s (available: %s)", req.Line, target, pythonVersion, strings.Join(files, ", "))
+	}
+	return fmt.Sprintf("%s: platform mismatch, no wheel for %s (available: %s)", req.Line, target, strings.Join(files, ", "))
+}
+
+// 去重并排序
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// 校验--wheelhouse参数并转换为绝对路径
+func resolveWheelhouse(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("wheelhouse %s is not a directory", dir)
+	}
+	return abs, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDistributionFileName(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     wheelFile
+		ok       bool
+	}{
+		{
+			fileName: "requests-2.32.3-py3-none-any.whl",
+			want:     wheelFile{Name: "requests", Version: "2.32.3", Python: "py3", ABI: "none", Platform: "any"},
+			ok:       true,
+		},
+		{
+			fileName: "pydantic_core-2.23.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+			want:     wheelFile{Name: "pydantic-core", Version: "2.23.4", Python: "cp312", ABI: "cp312", Platform: "manylinux_2_17_x86_64.manylinux2014_x86_64"},
+			ok:       true,
+		},
+		{
+			fileName: "pkg-1.0-1build-py3-none-any.whl",
+			want:     wheelFile{Name: "pkg", Version: "1.0", Python: "py3", ABI: "none", Platform: "any"},
+			ok:       true,
+		},
+		{
+			fileName: "Django-5.0.tar.gz",
+			want:     wheelFile{Name: "django", Version: "5.0", Sdist: true},
+			ok:       true,
+		},
+		{
+			fileName: "zope.interface-6.0.zip",
+			want:     wheelFile{Name: "zope-interface", Version: "6.0", Sdist: true},
+			ok:       true,
+		},
+		{fileName: "broken-1.0.whl"},
+		{fileName: "nodash.tar.gz"},
+		{fileName: "README.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			got, ok := parseDistributionFileName(tt.fileName)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			tt.want.FileName = tt.fileName
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWheelPlatformMatches(t *testing.T) {
+	var (
+		linuxAmd64  = targetPlatform{OS: "linux", Arch: "amd64"}
+		linuxArm64  = targetPlatform{OS: "linux", Arch: "arm64"}
+		darwinAmd64 = targetPlatform{OS: "darwin", Arch: "amd64"}
+		darwinArm64 = targetPlatform{OS: "darwin", Arch: "arm64"}
+	)
+
+	tests := []struct {
+		platform string
+		target   targetPlatform
+		want     bool
+	}{
+		{"any", linuxArm64, true},
+		{"manylinux_2_17_x86_64", linuxAmd64, true},
+		{"manylinux_2_17_x86_64", linuxArm64, false},
+		{"manylinux2014_aarch64", linuxArm64, true},
+		{"manylinux2014_aarch64", linuxAmd64, false},
+		{"manylinux1_x86_64", linuxAmd64, true},
+		{"manylinux1_i686", linuxAmd64, false},
+		{"linux_x86_64", linuxAmd64, true},
+		{"linux_armv7l", linuxArm64, false},
+		// musl的wheel无法安装到glibc的插件运行环境
+		{"musllinux_1_2_x86_64", linuxAmd64, false},
+		// 多个平台标签中任一匹配即可
+		{"manylinux_2_17_aarch64.manylinux2014_aarch64", linuxArm64, true},
+		{"musllinux_1_1_aarch64.manylinux_2_28_aarch64", linuxArm64, true},
+		{"macosx_10_9_x86_64", darwinAmd64, true},
+		{"macosx_10_9_x86_64", darwinArm64, false},
+		{"macosx_11_0_arm64", darwinArm64, true},
+		{"macosx_11_0_arm64", darwinAmd64, false},
+		{"macosx_10_9_universal2", darwinArm64, true},
+		{"macosx_10_9_universal2", darwinAmd64, true},
+		{"macosx_10_9_x86_64", linuxAmd64, false},
+		{"manylinux_2_17_x86_64", darwinAmd64, false},
+		{"win_amd64", linuxAmd64, false},
+		// 未指定平台时不检查
+		{"macosx_11_0_arm64", targetPlatform{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.platform+"/"+tt.target.String(), func(t *testing.T) {
+			wheel := wheelFile{Python: "py3", ABI: "none", Platform: tt.platform}
+			if got := wheel.platformMatches(tt.target); got != tt.want {
+				t.Errorf("platformMatches(%s) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+
+	if sdist := (wheelFile{Sdist: true}); !sdist.platformMatches(linuxArm64) {
+		t.Error("sdist does not match every platform")
+	}
+}
+
+func TestWheelPythonMatches(t *testing.T) {
+	tests := []struct {
+		python  string
+		abi     string
+		version string
+		want    bool
+	}{
+		{"py3", "none", "3.12", true},
+		{"py2.py3", "none", "3.12", true},
+		{"py312", "none", "3.12", true},
+		{"py311", "none", "3.12", false},
+		{"py2", "none", "3.12", false},
+		{"cp312", "cp312", "3.12", true},
+		{"cp311", "cp311", "3.12", false},
+		{"cp312", "cp312", "3.11", false},
+		{"cp310", "cp310", "3.1", false},
+		// abi3的wheel可以安装到不低于其标签的版本
+		{"cp38", "abi3", "3.12", true},
+		{"cp39", "abi3", "3.10", true},
+		{"cp312", "abi3", "3.12", true},
+		{"cp313", "abi3", "3.12", false},
+		{"cp310", "abi3", "3.9", false},
+		{"cp311", "abi3", "3.8", false},
+		// 非abi3的wheel只能用于对应的版本
+		{"cp38", "cp38", "3.12", false},
+		{"pp310", "pypy310_pp73", "3.10", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.python+"-"+tt.abi+"/"+tt.version, func(t *testing.T) {
+			wheel := wheelFile{Python: tt.python, ABI: tt.abi, Platform: "any"}
+			if got := wheel.pythonMatches(tt.version); got != tt.want {
+				t.Errorf("pythonMatches(%s) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRequirements(t *testing.T) {
+	content := `--no-index --find-links=./wheels/
+# comment
+-r other.txt
+requests==2.32.3  # pinned
+Flask>=3.0,<4
+uvicorn[standard]==0.30.6 ; python_version >= "3.8"
+dify_plugin @ https://example.com/dify_plugin-0.4.0-py3-none-any.whl
+pydantic-core==2.23.4 \
+    --hash=sha256:aaa \
+    --hash=sha256:bbb
+
+six
+`
+	path := filepath.Join(t.TempDir(), "requirements.txt")
+	os.WriteFile(path, []byte(content), 0644)
+
+	requirements, err := readRequirements(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []requirement{
+		{Line: "requests==2.32.3", Name: "requests", Specifier: "==2.32.3"},
+		{Line: "Flask>=3.0,<4", Name: "flask", Specifier: ">=3.0,<4"},
+		{Line: `uvicorn[standard]==0.30.6 ; python_version >= "3.8"`, Name: "uvicorn", Specifier: "==0.30.6"},
+		{Line: "pydantic-core==2.23.4", Name: "pydantic-core", Specifier: "==2.23.4", Hashes: []string{"aaa", "bbb"}},
+		{Line: "six", Name: "six"},
+	}
+	if !reflect.DeepEqual(requirements, want) {
+		t.Errorf("got  %+v\nwant %+v", requirements, want)
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		pinned, version string
+		want            bool
+	}{
+		{"2.32.3", "2.32.3", true},
+		{"2.32.3", "2.32.30", false},
+		{"2.32.*", "2.32.3", true},
+		{"2.32.*", "2.32", true},
+		{"2.32.*", "2.320.1", false},
+		{"2.*", "3.0", false},
+	}
+	for _, tt := range tests {
+		if got := versionMatches(tt.pinned, tt.version); got != tt.want {
+			t.Errorf("versionMatches(%q, %q) = %v, want %v", tt.pinned, tt.version, got, tt.want)
+		}
+	}
+
+	// 只有==且没有其他条件时视为固定版本
+	for specifier, want := range map[string]bool{"==1.0": true, "==1.*": true, ">=1.0": false, "==1.0,!=1.0.1": false, "": false} {
+		if _, got := (requirement{Specifier: specifier}).pinnedVersion(); got != want {
+			t.Errorf("pinnedVersion(%q) = %v, want %v", specifier, got, want)
+		}
+	}
+}
+
+func TestDiagnoseWheelhouse(t *testing.T) {
+	dir := t.TempDir()
+	wheelhouse := filepath.Join(dir, "wheelhouse")
+	os.MkdirAll(wheelhouse, 0755)
+	for _, name := range []string{
+		"requests-2.32.3-py3-none-any.whl",
+		"requests-2.31.0-py3-none-any.whl",
+		"pydantic_core-2.23.4-cp312-cp312-manylinux_2_17_x86_64.whl",
+		"cryptography-43.0.1-cp39-abi3-manylinux_2_28_aarch64.whl",
+		"numpy-2.1.0-cp311-cp311-manylinux_2_17_aarch64.whl",
+		"pyyaml-6.0.2.tar.gz",
+	} {
+		os.WriteFile(filepath.Join(wheelhouse, name), []byte("dist"), 0644)
+	}
+
+	requirementsPath := filepath.Join(dir, "requirements.txt")
+	os.WriteFile(requirementsPath, []byte(`requests==2.30.0
+pydantic-core==2.23.4
+cryptography==43.0.1
+numpy==2.1.0
+PyYAML==6.0.2
+flask
+`), 0644)
+
+	pipOutput := "ERROR: No matching distribution found for markupsafe>=2.1.1.\n" +
+		"ERROR: No matching distribution found for flask\n"
+	problems, err := diagnoseWheelhouse(requirementsPath, wheelhouse, targetPlatform{OS: "linux", Arch: "arm64"}, "3.12", pipOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"requests==2.30.0: version not found (available: 2.31.0, 2.32.3)",
+		"pydantic-core==2.23.4: platform mismatch, no wheel for linux/arm64 and Python 3.12 (available: pydantic_core-2.23.4-cp312-cp312-manylinux_2_17_x86_64.whl)",
+		"numpy==2.1.0: platform mismatch, no wheel for linux/arm64 and Python 3.12 (available: numpy-2.1.0-cp311-cp311-manylinux_2_17_aarch64.whl)",
+		"flask: not found",
+		"markupsafe>=2.1.1: not found (required by another package)",
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems:\n%q\nwant:\n%q", problems, want)
+	}
+
+	// 没有问题时返回空列表
+	os.WriteFile(requirementsPath, []byte("cryptography==43.0.1\npyyaml\n"), 0644)
+	if problems, err := diagnoseWheelhouse(requirementsPath, wheelhouse, targetPlatform{OS: "linux", Arch: "arm64"}, "3.12", ""); err != nil || len(problems) != 0 {
+		t.Errorf("problems = %q, %v", problems, err)
+	}
+
+	if _, err := diagnoseWheelhouse(requirementsPath, filepath.Join(dir, "missing"), targetPlatform{}, "", ""); err == nil {
+		t.Error("missing wheelhouse accepted")
+	}
+}